@@ -3,10 +3,11 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
@@ -21,11 +23,19 @@ import (
 	"time"
 
 	"main/utils/ampapi"
+	"main/utils/discography"
+	"main/utils/history"
 	"main/utils/lyrics"
+	"main/utils/mp4flat"
+	"main/utils/mp4meta"
+	"main/utils/naming"
+	"main/utils/playlistfile"
+	"main/utils/report"
 	"main/utils/runv2"
 	"main/utils/runv3"
 	"main/utils/structs"
 	"main/utils/task"
+	"main/utils/watch"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/fatih/color"
@@ -37,21 +47,39 @@ import (
 )
 
 var (
-	forbiddenNames = regexp.MustCompile(`[/\\<>:"|?*]`)
-	dl_atmos       bool
-	dl_aac         bool
-	dl_select      bool
-	dl_song        bool
-	artist_select  bool
-	debug_mode     bool
-	alac_max       *int
-	atmos_max      *int
-	mv_max         *int
-	mv_audio_type  *string
-	aac_type       *string
-	Config         structs.ConfigSet
-	counter        structs.Counter
-	okDict         = make(map[string][]int)
+	forbiddenNames    = regexp.MustCompile(`[/\\<>:"|?*]`)
+	dl_atmos          bool
+	dl_aac            bool
+	dl_select         bool
+	dl_song           bool
+	artist_select     bool
+	album_types       []string
+	prefer_rating     string
+	release_years     string
+	name_filter       string
+	collapse_editions bool
+	debug_mode        bool
+	non_interactive   bool
+	only_tracks       []string
+	url_artist_name   string
+	url_artist_id     string
+	alac_max          *int
+	atmos_max         *int
+	mv_max            *int
+	mv_audio_type     *string
+	aac_type          *string
+	Config            structs.ConfigSet
+	counter           structs.Counter
+	dlHistory         *history.Store
+	runReport         *report.Report
+	reportItem        *report.Item
+
+	artistFolderTemplate   *naming.Template
+	albumFolderTemplate    *naming.Template
+	playlistFolderTemplate *naming.Template
+	songFileTemplate       *naming.Template
+	discFolderTemplate     *naming.Template
+	workFolderTemplate     *naming.Template
 )
 
 func loadConfig() error {
@@ -66,9 +94,122 @@ func loadConfig() error {
 	if len(Config.Storefront) != 2 {
 		Config.Storefront = "us"
 	}
+	switch strings.ToLower(Config.PlaylistFileFormat) {
+	case "", "m3u8", "xspf", "both":
+	default:
+		return fmt.Errorf("invalid playlist-file-format %q, use m3u8, xspf, both or \"\"", Config.PlaylistFileFormat)
+	}
+	switch Config.ContentPreference {
+	case "", "both", "prefer-explicit", "prefer-clean":
+	default:
+		return fmt.Errorf("invalid content-preference %q, use prefer-explicit, prefer-clean or both", Config.ContentPreference)
+	}
+	switch Config.LyricsBackgroundVocals {
+	case "", "parentheses", "strip":
+	default:
+		return fmt.Errorf("invalid lyrics-background-vocals %q, use parentheses, strip or \"\"", Config.LyricsBackgroundVocals)
+	}
+	for _, part := range Config.LrcLines {
+		switch part {
+		case "original", "translation", "transliteration":
+		default:
+			return fmt.Errorf("invalid lrc-lines entry %q, use original, translation or transliteration", part)
+		}
+	}
+	switch Config.PlaylistDedupe {
+	case "", "symlink", "hardlink":
+	case "reference":
+		if Config.PlaylistFileFormat == "" {
+			return errors.New("playlist-dedupe \"reference\" needs a playlist-file-format")
+		}
+	default:
+		return fmt.Errorf("invalid playlist-dedupe %q, use reference, symlink, hardlink or \"\"", Config.PlaylistDedupe)
+	}
+	if err := parseTemplates(); err != nil {
+		return err
+	}
+	if Config.HistoryFile != "" {
+		dlHistory, err = history.Open(Config.HistoryFile)
+		if err != nil {
+			return fmt.Errorf("open history: %w", err)
+		}
+	}
 	return nil
 }
 
+// ownedTrack reports whether the track was already downloaded with the current codec.
+// Album tracks count as owned wherever the album library copy now lives, matched by catalog ID,
+// or by ISRC only for the same album so a compilation or deluxe edition is still completed;
+// playlist and station tracks only when downloaded for the same playlist or station.
+func ownedTrack(track *task.Track) (history.Entry, bool) {
+	if track.PreType == "albums" {
+		if e, ok := dlHistory.Find(history.Query{ID: track.ID, Codec: track.Codec, PreType: "albums"}); ok {
+			return e, true
+		}
+		return dlHistory.Find(history.Query{ISRC: track.Resp.Attributes.Isrc, Codec: track.Codec, PreType: "albums", PreID: track.PreID})
+	}
+	return dlHistory.Find(history.Query{ID: track.ID, ISRC: track.Resp.Attributes.Isrc, Codec: track.Codec, PreID: track.PreID})
+}
+
+// libraryFiles indexes the .m4a files of each save folder by "id:" cnID and "isrc:" ISRC,
+// built the first time a moved track has to be found.
+var libraryFiles = map[string]map[string]string{}
+
+// relocateOwned finds a track of the history that is no longer at its recorded path by searching
+// its save folder, and records the new path. It reports the path and whether the file was found.
+func relocateOwned(entry history.Entry) (string, bool) {
+	root := saveFolder(entry.Codec)
+	index, ok := libraryFiles[root]
+	if !ok {
+		index = map[string]string{}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".m4a") {
+				return nil
+			}
+			file, err := readRetagFile(path)
+			if err != nil {
+				return nil
+			}
+			if id := file.catalogID(); id != "" {
+				index["id:"+id] = path
+			}
+			if isrc := file.tags.Custom["ISRC"]; isrc != "" {
+				index["isrc:"+isrc] = path
+			}
+			return nil
+		})
+		libraryFiles[root] = index
+	}
+	path, ok := index["id:"+entry.ID]
+	if !ok && entry.ISRC != "" {
+		path, ok = index["isrc:"+entry.ISRC]
+	}
+	if !ok {
+		return "", false
+	}
+	entry.Path = path
+	if err := dlHistory.Add(entry); err != nil {
+		fmt.Println("Failed to write download history:", err)
+	}
+	return path, true
+}
+
+func recordHistory(track *task.Track) {
+	err := dlHistory.Add(history.Entry{
+		ID:      track.ID,
+		ISRC:    track.Resp.Attributes.Isrc,
+		Name:    track.Resp.Attributes.Name,
+		Codec:   track.Codec,
+		Quality: track.Quality,
+		Path:    track.SavePath,
+		PreType: track.PreType,
+		PreID:   track.PreID,
+	})
+	if err != nil {
+		fmt.Println("Failed to write download history:", err)
+	}
+}
+
 func LimitString(s string) string {
 	if len([]rune(s)) > Config.LimitMax {
 		return string([]rune(s)[:Config.LimitMax])
@@ -171,66 +312,70 @@ func getUrlSong(songUrl string, token string) (string, error) {
 }
 func getUrlArtistName(artistUrl string, token string) (string, string, error) {
 	storefront, artistId := checkUrlArtist(artistUrl)
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com/v1/catalog/%s/artists/%s", storefront, artistId), nil)
+	obj, err := ampapi.GetArtistResp(storefront, artistId, Config.Language, token)
 	if err != nil {
 		return "", "", err
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
-	query := url.Values{}
-	query.Set("l", Config.Language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", "", err
+	return obj.Data[0].Attributes.Name, obj.Data[0].ID, nil
+}
+
+// discographyFilter builds the artist album filter from the --album-type, --prefer-rating,
+// --years, --name-filter and --collapse-editions options.
+func discographyFilter() (discography.Filter, error) {
+	f := discography.Filter{Types: album_types, Rating: prefer_rating, Collapse: collapse_editions}
+	if f.Rating == "" {
+		f.Rating, _ = contentPreference()
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return "", "", errors.New(do.Status)
+	for _, t := range album_types {
+		if !contains(discography.Types, t) {
+			return f, fmt.Errorf("unknown album type %q", t)
+		}
 	}
-	obj := new(structs.AutoGeneratedArtist)
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return "", "", err
+	if prefer_rating != "" && prefer_rating != "explicit" && prefer_rating != "clean" {
+		return f, fmt.Errorf("prefer-rating must be explicit or clean, not %q", prefer_rating)
 	}
-	return obj.Data[0].Attributes.Name, obj.Data[0].ID, nil
+	var err error
+	if f.YearFrom, f.YearTo, err = discography.ParseYears(release_years); err != nil {
+		return f, err
+	}
+	if name_filter != "" {
+		if f.Name, err = regexp.Compile(name_filter); err != nil {
+			return f, fmt.Errorf("invalid name filter: %w", err)
+		}
+	}
+	return f, nil
 }
 
 func checkArtist(artistUrl string, token string, relationship string) ([]string, error) {
 	storefront, artistId := checkUrlArtist(artistUrl)
-	Num := 0
+	client := ampapi.NewClient(storefront, Config.Language, token)
+	filter, err := discographyFilter()
+	if err != nil {
+		return nil, err
+	}
 	//id := 1
 	var args []string
 	var urls []string
 	var options [][]string
-	for {
-		req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com/v1/catalog/%s/artists/%s/%s?limit=100&offset=%d&l=%s", storefront, artistId, relationship, Num, Config.Language), nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-		req.Header.Set("Origin", "https://music.apple.com")
-		do, err := http.DefaultClient.Do(req)
+	switch relationship {
+	case "albums":
+		albums, err := client.GetArtistAlbums(artistId)
 		if err != nil {
 			return nil, err
 		}
-		defer do.Body.Close()
-		if do.StatusCode != http.StatusOK {
-			return nil, errors.New(do.Status)
+		for _, album := range filter.Albums(albums) {
+			options = append(options, []string{album.Attributes.Name, album.Attributes.ReleaseDate, album.ID, album.Attributes.URL})
 		}
-		obj := new(structs.AutoGeneratedArtist)
-		err = json.NewDecoder(do.Body).Decode(&obj)
+	case "music-videos":
+		videos, err := client.GetArtistMusicVideos(artistId)
 		if err != nil {
 			return nil, err
 		}
-		for _, album := range obj.Data {
-			options = append(options, []string{album.Attributes.Name, album.Attributes.ReleaseDate, album.ID, album.Attributes.URL})
-		}
-		Num = Num + 100
-		if len(obj.Next) == 0 {
-			break
+		for _, video := range videos {
+			if !filter.Keep(video.Attributes.Name, video.Attributes.ReleaseDate) {
+				continue
+			}
+			options = append(options, []string{video.Attributes.Name, video.Attributes.ReleaseDate, video.ID, video.Attributes.URL})
 		}
 	}
 	sort.Slice(options, func(i, j int) bool {
@@ -262,7 +407,7 @@ func checkArtist(artistUrl string, token string, relationship string) ([]string,
 		table.Append(options[i])
 	}
 	table.Render()
-	if artist_select {
+	if artist_select || non_interactive {
 		fmt.Println("You have selected all options:")
 		return urls, nil
 	}
@@ -757,8 +902,379 @@ func convertIfNeeded(track *task.Track) {
 }
 
 func ripTrack(track *task.Track, token string, mediaUserToken string) {
-	var err error
+	outcome, err := downloadTrack(track, token, mediaUserToken)
+	backoff := time.Duration(Config.RetryBackoff) * time.Second
+	for attempt := 1; outcome == report.Error && attempt <= Config.TrackRetries; attempt++ {
+		fmt.Printf("Retrying in %s (%d/%d)...\n", backoff, attempt, Config.TrackRetries)
+		time.Sleep(backoff)
+		backoff *= 2
+		outcome, err = downloadTrack(track, token, mediaUserToken)
+	}
+	recordTrack(report.Track{
+		ID:      track.ID,
+		Type:    track.Type,
+		Name:    track.Name,
+		Path:    track.SavePath,
+		Codec:   track.Codec,
+		Quality: track.Quality,
+	}, outcome, err)
+}
+
+// recordTrack counts a processed track in the console summary and the run report.
+func recordTrack(t report.Track, outcome string, err error) {
 	counter.Total++
+	switch outcome {
+	case report.Success:
+		counter.Success++
+	case report.Unavailable:
+		counter.Unavailable++
+	case report.NotSong:
+		counter.NotSong++
+	default:
+		counter.Error++
+	}
+	t.Outcome = outcome
+	if err != nil {
+		t.Error = err.Error()
+	}
+	reportItem.AddTrack(t)
+}
+
+// saveFolder returns the library root for a codec.
+func saveFolder(codec string) string {
+	switch codec {
+	case "ATMOS":
+		return Config.AtmosSaveFolder
+	case "AAC":
+		return Config.AacSaveFolder
+	}
+	return Config.AlacSaveFolder
+}
+
+// Fields available to each naming template.
+var (
+	artistFolderFields = []string{"ArtistName", "UrlArtistName", "ArtistId"}
+	qualityFields      = []string{"Quality", "BitDepth", "SampleRate"}
+	albumInfoFields    = []string{"AlbumId", "AlbumName", "AlbumArtist", "ReleaseDate", "ReleaseYear", "UPC", "Copyright", "RecordLabel",
+		"GenreNames", "Genre", "IsCompilation", "IsSingle", "AlbumType", "DiscTotal", "TrackTotal"}
+	classicalFields      = []string{"WorkName", "MovementName", "MovementNumber", "MovementCount", "Attribution"}
+	discFolderFields     = []string{"DiscNumber", "DiscTotal"}
+	workFolderFields     = []string{"WorkName", "MovementCount", "Attribution", "ComposerName"}
+	albumFolderFields    = concat(albumInfoFields, qualityFields, []string{"ArtistName", "Codec", "Tag"})
+	playlistFolderFields = concat(qualityFields, []string{"PlaylistId", "PlaylistName", "ArtistName", "Codec", "Tag"})
+	songFileFields       = concat(albumInfoFields, qualityFields, []string{"SongId", "SongNumber", "SongNumer", "SongName", "DiscNumber", "TrackNumber",
+		"ArtistName", "ComposerName", "Isrc", "AudioLocale", "DurationInMillis", "Codec", "Tag"}, classicalFields)
+)
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// usesQuality reports whether rendering t needs the stream quality, which costs a manifest request.
+func usesQuality(t *naming.Template) bool {
+	for _, field := range qualityFields {
+		if t.Uses(field) {
+			return true
+		}
+	}
+	return false
+}
+
+var alacQuality = regexp.MustCompile(`^(\d+)B-([\d.]+)kHz$`)
+
+// setQuality fills the quality fields. Bit depth and sample rate are only known for ALAC,
+// whose quality reads like "24B-96.0kHz".
+func setQuality(fields naming.Fields, quality string) {
+	fields["Quality"] = quality
+	if m := alacQuality.FindStringSubmatch(quality); m != nil {
+		fields["BitDepth"] = m[1]
+		fields["SampleRate"] = strings.TrimSuffix(strings.TrimSuffix(m[2], "0"), ".") + "kHz"
+	}
+}
+
+// intField formats a count or number, leaving it empty when unknown so <...> segments can drop it.
+func intField(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// flagField renders a boolean attribute as its name, or empty when false.
+func flagField(b bool, name string) string {
+	if b {
+		return name
+	}
+	return ""
+}
+
+// albumType classifies a release as single, EP, album or compilation. The catalog marks
+// both singles and EPs with isSingle, so EPs are told apart by their name.
+func albumType(name string, isSingle bool, isCompilation bool) string {
+	switch {
+	case isCompilation:
+		return "compilation"
+	case strings.HasSuffix(name, " - EP"):
+		return "EP"
+	case isSingle || strings.HasSuffix(name, " - Single"):
+		return "single"
+	}
+	return "album"
+}
+
+// albumFields returns the album-level fields shared by folder and file names.
+func albumFields(album *ampapi.AlbumRespData) naming.Fields {
+	attrs := &album.Attributes
+	discTotal := 0
+	if tracks := album.Relationships.Tracks.Data; len(tracks) > 0 {
+		discTotal = tracks[len(tracks)-1].Attributes.DiscNumber
+	}
+	trackTotal := attrs.TrackCount
+	if trackTotal == 0 {
+		trackTotal = len(album.Relationships.Tracks.Data)
+	}
+	genre := ""
+	if len(attrs.GenreNames) > 0 {
+		genre = attrs.GenreNames[0]
+	}
+	return naming.Fields{
+		"AlbumId":       album.ID,
+		"AlbumName":     LimitString(attrs.Name),
+		"AlbumArtist":   LimitString(albumArtistName(attrs.ArtistName, attrs.IsCompilation)),
+		"ArtistName":    LimitString(albumArtistName(attrs.ArtistName, attrs.IsCompilation)),
+		"ReleaseDate":   attrs.ReleaseDate,
+		"ReleaseYear":   releaseYear(attrs.ReleaseDate),
+		"UPC":           attrs.Upc,
+		"Copyright":     attrs.Copyright,
+		"RecordLabel":   attrs.RecordLabel,
+		"GenreNames":    strings.Join(attrs.GenreNames, ", "),
+		"Genre":         genre,
+		"IsCompilation": flagField(attrs.IsCompilation, "Compilation"),
+		"IsSingle":      flagField(attrs.IsSingle, "Single"),
+		"AlbumType":     albumType(attrs.Name, attrs.IsSingle, attrs.IsCompilation),
+		"DiscTotal":     intField(discTotal),
+		"TrackTotal":    intField(trackTotal),
+	}
+}
+
+// parseTemplates parses and validates the folder and file name formats of the config.
+func parseTemplates() error {
+	formats := []struct {
+		key    string
+		format string
+		fields []string
+		t      **naming.Template
+	}{
+		{"artist-folder-format", Config.ArtistFolderFormat, artistFolderFields, &artistFolderTemplate},
+		{"album-folder-format", Config.AlbumFolderFormat, albumFolderFields, &albumFolderTemplate},
+		{"playlist-folder-format", Config.PlaylistFolderFormat, playlistFolderFields, &playlistFolderTemplate},
+		{"song-file-format", Config.SongFileFormat, songFileFields, &songFileTemplate},
+		{"disc-folder-format", Config.DiscFolderFormat, discFolderFields, &discFolderTemplate},
+		{"work-folder-format", Config.WorkFolderFormat, workFolderFields, &workFolderTemplate},
+	}
+	for _, f := range formats {
+		t, err := naming.Parse(f.format)
+		if err == nil {
+			err = t.Validate(f.fields)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", f.key, f.format, err)
+		}
+		*f.t = t
+	}
+	return nil
+}
+
+// folderName cleans up a rendered folder template.
+func folderName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		name = strings.ReplaceAll(name, ".", "")
+	}
+	return strings.TrimSpace(name)
+}
+
+// tagString joins the configured master, explicit and clean markers that apply.
+func tagString(isMaster bool, contentRating string) string {
+	stringsToJoin := []string{}
+	if isMaster && Config.AppleMasterChoice != "" {
+		stringsToJoin = append(stringsToJoin, Config.AppleMasterChoice)
+	}
+	if contentRating == "explicit" && Config.ExplicitChoice != "" {
+		stringsToJoin = append(stringsToJoin, Config.ExplicitChoice)
+	}
+	if contentRating == "clean" && Config.CleanChoice != "" {
+		stringsToJoin = append(stringsToJoin, Config.CleanChoice)
+	}
+	return strings.Join(stringsToJoin, " ")
+}
+
+// renderArtistFolder renders artist-folder-format. When the run was expanded from an artist page,
+// {UrlArtistName} and {ArtistId} are that artist rather than artistName and artistId.
+func renderArtistFolder(artistName string, artistId string) string {
+	fields := naming.Fields{
+		"ArtistName":    artistName,
+		"UrlArtistName": artistName,
+		"ArtistId":      artistId,
+	}
+	if url_artist_name != "" {
+		fields["UrlArtistName"] = url_artist_name
+		fields["ArtistId"] = url_artist_id
+	}
+	return folderName(artistFolderTemplate.Render(fields))
+}
+
+// albumArtistName returns compilation-artist for compilations, so their album artist is spelled
+// the same whatever the storefront language, and artistName otherwise.
+func albumArtistName(artistName string, isCompilation bool) string {
+	if isCompilation && Config.CompilationArtist != "" {
+		return Config.CompilationArtist
+	}
+	return artistName
+}
+
+// inCompilationFolder reports whether the album goes to compilation-folder instead of an artist folder.
+func inCompilationFolder(album *ampapi.AlbumRespData) bool {
+	return album.Attributes.IsCompilation && Config.CompilationFolder != ""
+}
+
+// artistFolderName renders artist-folder-format for an album, or returns compilation-folder.
+func artistFolderName(album *ampapi.AlbumRespData) string {
+	if inCompilationFolder(album) {
+		return Config.CompilationFolder
+	}
+	artistId := ""
+	if len(album.Relationships.Artists.Data) > 0 {
+		artistId = album.Relationships.Artists.Data[0].ID
+	}
+	return renderArtistFolder(LimitString(albumArtistName(album.Attributes.ArtistName, album.Attributes.IsCompilation)), artistId)
+}
+
+// renderAlbumFolder renders album-folder-format for an album.
+func renderAlbumFolder(album *ampapi.AlbumRespData, quality string, codec string) string {
+	fields := albumFields(album)
+	setQuality(fields, quality)
+	fields["Codec"] = codec
+	fields["Tag"] = tagString(album.Attributes.IsAppleDigitalMaster || album.Attributes.IsMasteredForItunes, album.Attributes.ContentRating)
+	return folderName(albumFolderTemplate.Render(fields))
+}
+
+// renderPlaylistFolder renders playlist-folder-format for a playlist or station.
+func renderPlaylistFolder(artistName string, name string, id string, quality string, codec string, tag string) string {
+	fields := naming.Fields{
+		"ArtistName":   artistName,
+		"PlaylistName": LimitString(name),
+		"PlaylistId":   id,
+		"Codec":        codec,
+		"Tag":          tag,
+	}
+	setQuality(fields, quality)
+	return folderName(playlistFolderTemplate.Render(fields))
+}
+
+// trackFolder returns the folder for a track of an album: albumFolderPath, then a disc-folder-format
+// subfolder on multi-disc albums and a work-folder-format subfolder for movements of a classical work.
+func trackFolder(albumFolderPath string, trackData *ampapi.TrackRespData, discTotal int) string {
+	folder := albumFolderPath
+	if Config.DiscFolderFormat != "" && discTotal > 1 {
+		folder = subfolder(folder, discFolderTemplate.Render(naming.Fields{
+			"DiscNumber": intField(trackData.Attributes.DiscNumber),
+			"DiscTotal":  intField(discTotal),
+		}))
+	}
+	if Config.WorkFolderFormat != "" && trackData.Attributes.WorkName != "" {
+		folder = subfolder(folder, workFolderTemplate.Render(naming.Fields{
+			"WorkName":      LimitString(trackData.Attributes.WorkName),
+			"MovementCount": intField(trackData.Attributes.MovementCount),
+			"Attribution":   LimitString(trackData.Attributes.Attribution),
+			"ComposerName":  LimitString(trackData.Attributes.ComposerName),
+		}))
+	}
+	return folder
+}
+
+func subfolder(parent string, name string) string {
+	name = folderName(name)
+	if name == "" {
+		return parent
+	}
+	return filepath.Join(parent, forbiddenNames.ReplaceAllString(name, "_"))
+}
+
+// songNumber is the {SongNumber} of an album track at position: its number on the disc when
+// song-number-per-disc is set and the album has several discs.
+func songNumber(trackData *ampapi.TrackRespData, position int, discTotal int) int {
+	if Config.SongNumberPerDisc && discTotal > 1 && trackData.Attributes.TrackNumber > 0 {
+		return trackData.Attributes.TrackNumber
+	}
+	return position
+}
+
+// songFileName renders song-file-format (without extension) for a track at position songNumber.
+// album may be nil, e.g. for playlist tracks, in which case the album fields come from the track.
+func songFileName(trackData *ampapi.TrackRespData, album *ampapi.AlbumRespData, songNumber int, quality string, codec string) string {
+	var fields naming.Fields
+	if album != nil && album.ID != "" {
+		fields = albumFields(album)
+	} else {
+		fields = naming.Fields{"AlbumName": LimitString(trackData.Attributes.AlbumName)}
+		if len(trackData.Relationships.Albums.Data) > 0 {
+			a := trackData.Relationships.Albums.Data[0]
+			fields["AlbumId"] = a.ID
+			fields["AlbumName"] = LimitString(a.Attributes.Name)
+			fields["AlbumArtist"] = LimitString(albumArtistName(a.Attributes.ArtistName, a.Attributes.IsCompilation))
+			fields["UPC"] = a.Attributes.Upc
+			fields["IsCompilation"] = flagField(a.Attributes.IsCompilation, "Compilation")
+			fields["IsSingle"] = flagField(a.Attributes.IsSingle, "Single")
+			fields["AlbumType"] = albumType(a.Attributes.Name, a.Attributes.IsSingle, a.Attributes.IsCompilation)
+			fields["TrackTotal"] = intField(a.Attributes.TrackCount)
+		}
+	}
+	attrs := &trackData.Attributes
+	fields["SongId"] = trackData.ID
+	fields["SongNumber"] = fmt.Sprintf("%02d", songNumber)
+	fields["SongNumer"] = fields["SongNumber"]
+	fields["SongName"] = LimitString(attrs.Name)
+	fields["DiscNumber"] = fmt.Sprintf("%0d", attrs.DiscNumber)
+	fields["TrackNumber"] = fmt.Sprintf("%0d", attrs.TrackNumber)
+	fields["ArtistName"] = LimitString(attrs.ArtistName)
+	fields["ComposerName"] = LimitString(attrs.ComposerName)
+	fields["Isrc"] = attrs.Isrc
+	fields["AudioLocale"] = attrs.AudioLocale
+	fields["DurationInMillis"] = intField(attrs.DurationInMillis)
+	fields["WorkName"] = LimitString(attrs.WorkName)
+	fields["MovementName"] = LimitString(attrs.MovementName)
+	fields["MovementNumber"] = intField(attrs.MovementNumber)
+	fields["MovementCount"] = intField(attrs.MovementCount)
+	fields["Attribution"] = LimitString(attrs.Attribution)
+	if attrs.ReleaseDate != "" {
+		fields["ReleaseDate"] = attrs.ReleaseDate
+		fields["ReleaseYear"] = releaseYear(attrs.ReleaseDate)
+	}
+	if len(attrs.GenreNames) > 0 {
+		fields["GenreNames"] = strings.Join(attrs.GenreNames, ", ")
+		fields["Genre"] = attrs.GenreNames[0]
+	}
+	setQuality(fields, quality)
+	fields["Tag"] = tagString(attrs.IsAppleDigitalMaster, attrs.ContentRating)
+	fields["Codec"] = codec
+	return songFileTemplate.Render(fields)
+}
+
+// releaseYear returns the year of a YYYY-MM-DD release date.
+func releaseYear(date string) string {
+	if len(date) < 4 {
+		return date
+	}
+	return date[:4]
+}
+
+// downloadTrack downloads, tags and converts a single track and returns its report outcome.
+func downloadTrack(track *task.Track, token string, mediaUserToken string) (string, error) {
+	var err error
 	fmt.Printf("Track %d of %d: %s\n", track.TaskNum, track.TaskTotal, track.Type)
 
 	//提前获取到的播放列表下track所在的专辑信息
@@ -770,22 +1286,31 @@ func ripTrack(track *task.Track, token string, mediaUserToken string) {
 	if track.Type == "music-videos" {
 		if len(mediaUserToken) <= 50 {
 			fmt.Println("meida-user-token is not set, skip MV dl")
-			counter.Success++
-			return
+			return report.Unavailable, errors.New("media-user-token is not set")
 		}
 		if _, err := exec.LookPath("mp4decrypt"); err != nil {
 			fmt.Println("mp4decrypt is not found, skip MV dl")
-			counter.Success++
-			return
+			return report.Unavailable, errors.New("mp4decrypt is not found")
 		}
 		err := mvDownloader(track.ID, track.SaveDir, token, track.Storefront, mediaUserToken, track)
 		if err != nil {
 			fmt.Println("\u26A0 Failed to dl MV:", err)
-			counter.Error++
-			return
+			return report.Error, err
 		}
-		counter.Success++
-		return
+		return report.Success, nil
+	}
+
+	if entry, ok := ownedTrack(track); ok {
+		if exists, _ := fileExists(entry.Path); !exists {
+			if path, found := relocateOwned(entry); found {
+				entry.Path = path
+			} else {
+				fmt.Println("Track already downloaded but not found, delete its line from the history file to download it again:", entry.Path)
+			}
+		}
+		fmt.Println("Track already downloaded:", entry.Path)
+		track.SavePath = entry.Path
+		return report.Success, nil
 	}
 
 	needDlAacLc := false
@@ -795,8 +1320,7 @@ func ripTrack(track *task.Track, token string, mediaUserToken string) {
 	if track.WebM3u8 == "" && !needDlAacLc {
 		if dl_atmos {
 			fmt.Println("Unavailable")
-			counter.Unavailable++
-			return
+			return report.Unavailable, errors.New("no lossless or Atmos stream available")
 		}
 		fmt.Println("Unavailable, trying to dl aac-lc")
 		needDlAacLc = true
@@ -817,7 +1341,7 @@ func ripTrack(track *task.Track, token string, mediaUserToken string) {
 		}
 	}
 	var Quality string
-	if strings.Contains(Config.SongFileFormat, "Quality") {
+	if usesQuality(songFileTemplate) {
 		if dl_atmos {
 			Quality = fmt.Sprintf("%dKbps", Config.AtmosMax-2000)
 		} else if needDlAacLc {
@@ -826,45 +1350,27 @@ func ripTrack(track *task.Track, token string, mediaUserToken string) {
 			_, Quality, err = extractMedia(track.M3u8, true)
 			if err != nil {
 				fmt.Println("Failed to extract quality from manifest.\n", err)
-				counter.Error++
-				return
+				return report.Error, err
 			}
 		}
 	}
 	track.Quality = Quality
 
-	stringsToJoin := []string{}
-	if track.Resp.Attributes.IsAppleDigitalMaster {
-		if Config.AppleMasterChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.AppleMasterChoice)
-		}
-	}
-	if track.Resp.Attributes.ContentRating == "explicit" {
-		if Config.ExplicitChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.ExplicitChoice)
-		}
-	}
-	if track.Resp.Attributes.ContentRating == "clean" {
-		if Config.CleanChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.CleanChoice)
-		}
+	number := track.TaskNum
+	if track.PreType == "albums" {
+		number = songNumber(&track.Resp, track.TaskNum, track.DiscTotal)
 	}
-	Tag_string := strings.Join(stringsToJoin, " ")
-
-	songName := strings.NewReplacer(
-		"{SongId}", track.ID,
-		"{SongNumer}", fmt.Sprintf("%02d", track.TaskNum),
-		"{SongName}", LimitString(track.Resp.Attributes.Name),
-		"{DiscNumber}", fmt.Sprintf("%0d", track.Resp.Attributes.DiscNumber),
-		"{TrackNumber}", fmt.Sprintf("%0d", track.Resp.Attributes.TrackNumber),
-		"{Quality}", Quality,
-		"{Tag}", Tag_string,
-		"{Codec}", track.Codec,
-	).Replace(Config.SongFileFormat)
+	songName := songFileName(&track.Resp, &track.AlbumData, number, Quality, track.Codec)
 	fmt.Println(songName)
 	filename := fmt.Sprintf("%s.m4a", forbiddenNames.ReplaceAllString(songName, "_"))
 	track.SaveName = filename
 	trackPath := filepath.Join(track.SaveDir, track.SaveName)
+	track.SavePath = trackPath
+	// disc and work folders are only created once one of their tracks is downloaded
+	if err := os.MkdirAll(track.SaveDir, os.ModePerm); err != nil {
+		fmt.Println("Failed to create folder:", err)
+		return report.Error, err
+	}
 	lrcFilename := fmt.Sprintf("%s.%s", forbiddenNames.ReplaceAllString(songName, "_"), Config.LrcFormat)
 
 	// Determine possible post-conversion target file (so we can skip re-download)
@@ -877,23 +1383,27 @@ func ripTrack(track *task.Track, token string, mediaUserToken string) {
 		convertedPath = strings.TrimSuffix(trackPath, filepath.Ext(trackPath)) + "." + strings.ToLower(Config.ConvertFormat)
 		considerConverted = true
 	}
+	if Config.PlaylistDedupe != "" && track.PreType != "albums" && dedupeTrack(track, trackPath, token) {
+		recordHistory(track)
+		return report.Success, nil
+	}
+
 	//get lrc
 	var lrc string = ""
 	if Config.EmbedLrc || Config.SaveLrcFile {
-		lrcStr, err := lyrics.Get(track.Storefront, track.ID, Config.LrcType, Config.Language, Config.LrcFormat, token, mediaUserToken)
+		lrcStr, lrcEmbed, err := trackLyrics(track, token, mediaUserToken)
 		if err != nil {
 			fmt.Println(err)
-		} else {
-			if Config.SaveLrcFile {
-				err := writeLyrics(track.SaveDir, lrcFilename, lrcStr)
-				if err != nil {
-					fmt.Printf("Failed to write lyrics")
-				}
-			}
-			if Config.EmbedLrc {
-				lrc = lrcStr
+		}
+		if Config.SaveLrcFile && lrcStr != "" {
+			err := writeLyrics(track.SaveDir, lrcFilename, lrcStr)
+			if err != nil {
+				fmt.Printf("Failed to write lyrics")
 			}
 		}
+		if Config.EmbedLrc {
+			lrc = lrcEmbed
+		}
 	}
 
 	// Existence check now considers converted output (if original was deleted)
@@ -903,92 +1413,78 @@ func ripTrack(track *task.Track, token string, mediaUserToken string) {
 	}
 	if existsOriginal {
 		fmt.Println("Track already exists locally.")
-		counter.Success++
-		okDict[track.PreID] = append(okDict[track.PreID], track.TaskNum)
-		return
+		track.SavePath = trackPath
+		recordHistory(track)
+		return report.Success, nil
 	}
 	if considerConverted {
 		existsConverted, err2 := fileExists(convertedPath)
 		if err2 == nil && existsConverted {
 			fmt.Println("Converted track already exists locally.")
-			counter.Success++
-			okDict[track.PreID] = append(okDict[track.PreID], track.TaskNum)
-			return
+			track.SavePath = convertedPath
+			recordHistory(track)
+			return report.Success, nil
 		}
 	}
 
 	if needDlAacLc {
 		if len(mediaUserToken) <= 50 {
 			fmt.Println("Invalid media-user-token")
-			counter.Error++
-			return
+			return report.Error, errors.New("invalid media-user-token")
 		}
 		_, err := runv3.Run(track.ID, trackPath, token, mediaUserToken, false, "")
 		if err != nil {
 			fmt.Println("Failed to dl aac-lc:", err)
+			os.Remove(trackPath)
 			if err.Error() == "Unavailable" {
-				counter.Unavailable++
-				return
+				return report.Unavailable, err
 			}
-			counter.Error++
-			return
+			return report.Error, err
 		}
 	} else {
 		trackM3u8Url, _, err := extractMedia(track.M3u8, false)
 		if err != nil {
 			fmt.Println("\u26A0 Failed to extract info from manifest:", err)
-			counter.Unavailable++
-			return
+			return report.Unavailable, err
 		}
 		//边下载边解密
 		err = runv2.Run(track.ID, trackM3u8Url, trackPath, Config)
 		if err != nil {
 			fmt.Println("Failed to run v2:", err)
-			counter.Error++
-			return
+			os.Remove(trackPath)
+			return report.Error, err
 		}
 	}
-	//这里利用MP4box将fmp4转化为mp4，并添加ilst box与cover，方便后面的mp4tag添加更多自定义标签
-	tags := []string{
-		"tool=",
-		"artist=AppleMusic",
+	//将fmp4转化为普通mp4，方便mp4tag添加标签与封面
+	if err := mp4flat.Flatten(trackPath); err != nil {
+		fmt.Println("Failed to remux:", err)
+		os.Remove(trackPath)
+		return report.Error, err
 	}
-	if Config.EmbedCover {
-		if (strings.Contains(track.PreID, "pl.") || strings.Contains(track.PreID, "ra.")) && Config.DlAlbumcoverForPlaylist {
-			track.CoverPath, err = writeCover(track.SaveDir, track.ID, track.Resp.Attributes.Artwork.URL)
-			if err != nil {
-				fmt.Println("Failed to write cover.")
-			}
+	perTrackCover := Config.EmbedCover && (strings.Contains(track.PreID, "pl.") || strings.Contains(track.PreID, "ra.")) && Config.DlAlbumcoverForPlaylist
+	if perTrackCover {
+		track.CoverPath, err = writeCover(track.SaveDir, track.ID, track.Resp.Attributes.Artwork.URL)
+		if err != nil {
+			fmt.Println("Failed to write cover.")
 		}
-		tags = append(tags, fmt.Sprintf("cover=%s", track.CoverPath))
-	}
-	tagsString := strings.Join(tags, ":")
-	cmd := exec.Command("MP4Box", "-itags", tagsString, trackPath)
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Embed failed: %v\n", err)
-		counter.Error++
-		return
 	}
-	if (strings.Contains(track.PreID, "pl.") || strings.Contains(track.PreID, "ra.")) && Config.DlAlbumcoverForPlaylist {
+	err = writeMP4Tags(track, lrc)
+	if perTrackCover {
 		if err := os.Remove(track.CoverPath); err != nil {
 			fmt.Printf("Error deleting file: %s\n", track.CoverPath)
-			counter.Error++
-			return
+			return report.Error, err
 		}
 	}
-	track.SavePath = trackPath
-	err = writeMP4Tags(track, lrc)
 	if err != nil {
 		fmt.Println("\u26A0 Failed to write tags in media:", err)
-		counter.Unavailable++
-		return
+		return report.Unavailable, err
 	}
 
 	// CONVERSION FEATURE hook
 	convertIfNeeded(track)
 
-	counter.Success++
-	okDict[track.PreID] = append(okDict[track.PreID], track.TaskNum)
+	recordHistory(track)
+	return report.Success, nil
 }
 
 func ripStation(albumId string, token string, storefront string, mediaUserToken string) error {
@@ -1009,17 +1505,8 @@ func ripStation(albumId string, token string, storefront string, mediaUserToken
 		Codec = "ALAC"
 	}
 	station.Codec = Codec
-	var singerFoldername string
-	if Config.ArtistFolderFormat != "" {
-		singerFoldername = strings.NewReplacer(
-			"{ArtistName}", "Apple Music Station",
-			"{ArtistId}", "",
-			"{UrlArtistName}", "Apple Music Station",
-		).Replace(Config.ArtistFolderFormat)
-		if strings.HasSuffix(singerFoldername, ".") {
-			singerFoldername = strings.ReplaceAll(singerFoldername, ".", "")
-		}
-		singerFoldername = strings.TrimSpace(singerFoldername)
+	singerFoldername := renderArtistFolder("Apple Music Station", "")
+	if singerFoldername != "" {
 		fmt.Println(singerFoldername)
 	}
 	singerFolder := filepath.Join(Config.AlacSaveFolder, forbiddenNames.ReplaceAllString(singerFoldername, "_"))
@@ -1032,18 +1519,12 @@ func ripStation(albumId string, token string, storefront string, mediaUserToken
 	os.MkdirAll(singerFolder, os.ModePerm)
 	station.SaveDir = singerFolder
 
-	playlistFolder := strings.NewReplacer(
-		"{ArtistName}", "Apple Music Station",
-		"{PlaylistName}", LimitString(station.Name),
-		"{PlaylistId}", station.ID,
-		"{Quality}", "",
-		"{Codec}", Codec,
-		"{Tag}", "",
-	).Replace(Config.PlaylistFolderFormat)
-	if strings.HasSuffix(playlistFolder, ".") {
-		playlistFolder = strings.ReplaceAll(playlistFolder, ".", "")
-	}
-	playlistFolder = strings.TrimSpace(playlistFolder)
+	// stations are only available as 256Kbps AAC
+	stationQuality := ""
+	if station.Type == "stream" {
+		stationQuality = "256Kbps"
+	}
+	playlistFolder := renderPlaylistFolder("Apple Music Station", station.Name, station.ID, stationQuality, Codec, "")
 	playlistFolderPath := filepath.Join(singerFolder, forbiddenNames.ReplaceAllString(playlistFolder, "_"))
 	os.MkdirAll(playlistFolderPath, os.ModePerm)
 	station.SaveName = playlistFolder
@@ -1087,27 +1568,41 @@ func ripStation(albumId string, token string, storefront string, mediaUserToken
 		}
 	}
 	if station.Type == "stream" {
-		counter.Total++
-		if isInArray(okDict[station.ID], 1) {
-			counter.Success++
+		streamTrack := report.Track{ID: station.ID, Type: "stations", Name: station.Name, Codec: "AAC", Quality: "256Kbps"}
+		if entry, ok := dlHistory.Find(history.Query{ID: station.ID, PreID: station.ID}); ok {
+			fmt.Println("Radio already downloaded:", entry.Path)
+			streamTrack.Path = entry.Path
+			recordTrack(streamTrack, report.Success, nil)
 			return nil
 		}
-		songName := strings.NewReplacer(
-			"{SongId}", station.ID,
-			"{SongNumer}", "01",
-			"{SongName}", LimitString(station.Name),
-			"{DiscNumber}", "1",
-			"{TrackNumber}", "1",
-			"{Quality}", "256Kbps",
-			"{Tag}", "",
-			"{Codec}", "AAC",
-		).Replace(Config.SongFileFormat)
+		streamEntry := history.Entry{
+			ID:      station.ID,
+			Name:    station.Name,
+			Codec:   "AAC",
+			Quality: "256Kbps",
+			PreType: "stations",
+			PreID:   station.ID,
+		}
+		songName := songFileTemplate.Render(naming.Fields{
+			"SongId":      station.ID,
+			"SongNumber":  "01",
+			"SongNumer":   "01",
+			"SongName":    LimitString(station.Name),
+			"DiscNumber":  "1",
+			"TrackNumber": "1",
+			"Quality":     "256Kbps",
+			"Codec":       "AAC",
+		})
 		fmt.Println(songName)
 		trackPath := filepath.Join(playlistFolderPath, fmt.Sprintf("%s.m4a", forbiddenNames.ReplaceAllString(songName, "_")))
 		exists, _ := fileExists(trackPath)
+		streamEntry.Path = trackPath
+		streamTrack.Path = trackPath
 		if exists {
-			counter.Success++
-			okDict[station.ID] = append(okDict[station.ID], 1)
+			recordTrack(streamTrack, report.Success, nil)
+			if err := dlHistory.Add(streamEntry); err != nil {
+				fmt.Println("Failed to write download history:", err)
+			}
 
 			fmt.Println("Radio already exists locally.")
 			return nil
@@ -1115,38 +1610,41 @@ func ripStation(albumId string, token string, storefront string, mediaUserToken
 		assetsUrl, serverUrl, err := ampapi.GetStationAssetsUrlAndServerUrl(station.ID, mediaUserToken, token)
 		if err != nil {
 			fmt.Println("Failed to get station assets url.", err)
-			counter.Error++
-			return err
+			recordTrack(streamTrack, report.Error, err)
+			return nil
 		}
 		trackM3U8 := strings.ReplaceAll(assetsUrl, "index.m3u8", "256/prog_index.m3u8")
 		keyAndUrls, _ := runv3.Run(station.ID, trackM3U8, token, mediaUserToken, true, serverUrl)
 		err = runv3.ExtMvData(keyAndUrls, trackPath)
 		if err != nil {
 			fmt.Println("Failed to download station stream.", err)
-			counter.Error++
-			return err
+			recordTrack(streamTrack, report.Error, err)
+			return nil
 		}
-		tags := []string{
-			"tool=",
-			"disk=1/1",
-			"track=1",
-			"tracknum=1/1",
-			fmt.Sprintf("artist=%s", "Apple Music Station"),
-			fmt.Sprintf("performer=%s", "Apple Music Station"),
-			fmt.Sprintf("album_artist=%s", "Apple Music Station"),
-			fmt.Sprintf("album=%s", station.Name),
-			fmt.Sprintf("title=%s", station.Name),
+		t := &mp4tag.MP4Tags{
+			DiscNumber:  1,
+			DiscTotal:   1,
+			TrackNumber: 1,
+			TrackTotal:  1,
+			Artist:      "Apple Music Station",
+			AlbumArtist: "Apple Music Station",
+			Album:       station.Name,
+			Title:       station.Name,
+			Custom:      map[string]string{"PERFORMER": "Apple Music Station"},
 		}
+		coverPath := ""
 		if Config.EmbedCover {
-			tags = append(tags, fmt.Sprintf("cover=%s", station.CoverPath))
+			coverPath = station.CoverPath
 		}
-		tagsString := strings.Join(tags, ":")
-		cmd := exec.Command("MP4Box", "-itags", tagsString, trackPath)
-		if err := cmd.Run(); err != nil {
+		if err := mp4flat.Flatten(trackPath); err != nil {
+			fmt.Println("Failed to remux:", err)
+		} else if err := tagFile(trackPath, t, coverPath); err != nil {
 			fmt.Printf("Embed failed: %v\n", err)
 		}
-		counter.Success++
-		okDict[station.ID] = append(okDict[station.ID], 1)
+		recordTrack(streamTrack, report.Success, nil)
+		if err := dlHistory.Add(streamEntry); err != nil {
+			fmt.Println("Failed to write download history:", err)
+		}
 		return nil
 	}
 
@@ -1168,16 +1666,24 @@ func ripStation(albumId string, token string, storefront string, mediaUserToken
 	}
 	for i := range station.Tracks {
 		i++
-		if isInArray(selected, i) {
+		if isInArray(selected, i) && wantTrack(station.Tracks[i-1].ID) {
 			ripTrack(&station.Tracks[i-1], token, mediaUserToken)
 		}
 	}
+	writePlaylistFiles(playlistFolderPath, playlistFolder, station.Name, station.Tracks)
 	return nil
 }
 
-func ripAlbum(albumId string, token string, storefront string, mediaUserToken string, urlArg_i string) error {
+// ripAlbum downloads an album. resp, when not nil, is the album's response fetched beforehand
+// (see preferredAlbum) and saves fetching it again.
+func ripAlbum(albumId string, token string, storefront string, mediaUserToken string, urlArg_i string, resp *ampapi.AlbumResp) error {
 	album := task.NewAlbum(storefront, albumId)
-	err := album.GetResp(token, Config.Language)
+	var err error
+	if resp != nil {
+		album.SetResp(resp, Config.Language)
+	} else {
+		err = album.GetResp(token, Config.Language)
+	}
 	if err != nil {
 		fmt.Println("Failed to get album response.")
 		return err
@@ -1234,38 +1740,15 @@ func ripAlbum(albumId string, token string, storefront string, mediaUserToken st
 		Codec = "ALAC"
 	}
 	album.Codec = Codec
-	var singerFoldername string
-	if Config.ArtistFolderFormat != "" {
-		if len(meta.Data[0].Relationships.Artists.Data) > 0 {
-			singerFoldername = strings.NewReplacer(
-				"{UrlArtistName}", LimitString(meta.Data[0].Attributes.ArtistName),
-				"{ArtistName}", LimitString(meta.Data[0].Attributes.ArtistName),
-				"{ArtistId}", meta.Data[0].Relationships.Artists.Data[0].ID,
-			).Replace(Config.ArtistFolderFormat)
-		} else {
-			singerFoldername = strings.NewReplacer(
-				"{UrlArtistName}", LimitString(meta.Data[0].Attributes.ArtistName),
-				"{ArtistName}", LimitString(meta.Data[0].Attributes.ArtistName),
-				"{ArtistId}", "",
-			).Replace(Config.ArtistFolderFormat)
-		}
-		if strings.HasSuffix(singerFoldername, ".") {
-			singerFoldername = strings.ReplaceAll(singerFoldername, ".", "")
-		}
-		singerFoldername = strings.TrimSpace(singerFoldername)
+	singerFoldername := artistFolderName(&meta.Data[0])
+	if singerFoldername != "" {
 		fmt.Println(singerFoldername)
 	}
-	singerFolder := filepath.Join(Config.AlacSaveFolder, forbiddenNames.ReplaceAllString(singerFoldername, "_"))
-	if dl_atmos {
-		singerFolder = filepath.Join(Config.AtmosSaveFolder, forbiddenNames.ReplaceAllString(singerFoldername, "_"))
-	}
-	if dl_aac {
-		singerFolder = filepath.Join(Config.AacSaveFolder, forbiddenNames.ReplaceAllString(singerFoldername, "_"))
-	}
+	singerFolder := filepath.Join(saveFolder(Codec), forbiddenNames.ReplaceAllString(singerFoldername, "_"))
 	os.MkdirAll(singerFolder, os.ModePerm)
 	album.SaveDir = singerFolder
 	var Quality string
-	if strings.Contains(Config.AlbumFolderFormat, "Quality") {
+	if usesQuality(albumFolderTemplate) {
 		if dl_atmos {
 			Quality = fmt.Sprintf("%dKbps", Config.AtmosMax-2000)
 		} else if dl_aac && Config.AacType == "aac-lc" {
@@ -1301,47 +1784,12 @@ func ripAlbum(albumId string, token string, storefront string, mediaUserToken st
 			}
 		}
 	}
-	stringsToJoin := []string{}
-	if meta.Data[0].Attributes.IsAppleDigitalMaster || meta.Data[0].Attributes.IsMasteredForItunes {
-		if Config.AppleMasterChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.AppleMasterChoice)
-		}
-	}
-	if meta.Data[0].Attributes.ContentRating == "explicit" {
-		if Config.ExplicitChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.ExplicitChoice)
-		}
-	}
-	if meta.Data[0].Attributes.ContentRating == "clean" {
-		if Config.CleanChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.CleanChoice)
-		}
-	}
-	Tag_string := strings.Join(stringsToJoin, " ")
-	var albumFolderName string
-	albumFolderName = strings.NewReplacer(
-		"{ReleaseDate}", meta.Data[0].Attributes.ReleaseDate,
-		"{ReleaseYear}", meta.Data[0].Attributes.ReleaseDate[:4],
-		"{ArtistName}", LimitString(meta.Data[0].Attributes.ArtistName),
-		"{AlbumName}", LimitString(meta.Data[0].Attributes.Name),
-		"{UPC}", meta.Data[0].Attributes.Upc,
-		"{RecordLabel}", meta.Data[0].Attributes.RecordLabel,
-		"{Copyright}", meta.Data[0].Attributes.Copyright,
-		"{AlbumId}", albumId,
-		"{Quality}", Quality,
-		"{Codec}", Codec,
-		"{Tag}", Tag_string,
-	).Replace(Config.AlbumFolderFormat)
-
-	if strings.HasSuffix(albumFolderName, ".") {
-		albumFolderName = strings.ReplaceAll(albumFolderName, ".", "")
-	}
-	albumFolderName = strings.TrimSpace(albumFolderName)
+	albumFolderName := renderAlbumFolder(&meta.Data[0], Quality, Codec)
 	albumFolderPath := filepath.Join(singerFolder, forbiddenNames.ReplaceAllString(albumFolderName, "_"))
 	os.MkdirAll(albumFolderPath, os.ModePerm)
 	album.SaveName = albumFolderName
 	fmt.Println(albumFolderName)
-	if Config.SaveArtistCover && len(meta.Data[0].Relationships.Artists.Data) > 0{
+	if Config.SaveArtistCover && !inCompilationFolder(&meta.Data[0]) && len(meta.Data[0].Relationships.Artists.Data) > 0 {
 		if meta.Data[0].Relationships.Artists.Data[0].Attributes.Artwork.Url != "" {
 			_, err = writeCover(singerFolder, "folder", meta.Data[0].Relationships.Artists.Data[0].Attributes.Artwork.Url)
 			if err != nil {
@@ -1407,7 +1855,7 @@ func ripAlbum(albumId string, token string, storefront string, mediaUserToken st
 	}
 	for i := range album.Tracks {
 		album.Tracks[i].CoverPath = covPath
-		album.Tracks[i].SaveDir = albumFolderPath
+		album.Tracks[i].SaveDir = trackFolder(albumFolderPath, &album.Tracks[i].Resp, album.Tracks[i].DiscTotal)
 		album.Tracks[i].Codec = Codec
 	}
 	trackTotal := len(meta.Data[0].Relationships.Tracks.Data)
@@ -1429,25 +1877,172 @@ func ripAlbum(albumId string, token string, storefront string, mediaUserToken st
 		return nil
 	}
 	var selected []int
-	if !dl_select {
+	if !dl_select || non_interactive || len(only_tracks) > 0 {
 		selected = arr
 	} else {
 		selected = album.ShowSelect()
 	}
 	for i := range album.Tracks {
 		i++
-		if isInArray(okDict[albumId], i) {
-			counter.Total++
-			counter.Success++
-			continue
-		}
-		if isInArray(selected, i) {
+		if isInArray(selected, i) && wantTrack(album.Tracks[i-1].ID) {
 			ripTrack(&album.Tracks[i-1], token, mediaUserToken)
 		}
 	}
 	return nil
 
 }
+
+// contentPreference returns the rating content-preference asks for, "explicit" or "clean",
+// and the rating it replaces. Both are "" when either edition is fine.
+func contentPreference() (string, string) {
+	switch Config.ContentPreference {
+	case "prefer-explicit":
+		return "explicit", "clean"
+	case "prefer-clean":
+		return "clean", "explicit"
+	}
+	return "", ""
+}
+
+// equivalentAlbum returns the edition of album with the preferred rating, or nil when album
+// already has it, is not rated, or has no such edition. The other versions of the album are
+// searched first, then the artist's albums with the same name.
+func equivalentAlbum(client *ampapi.Client, album *ampapi.AlbumRespData) (*ampapi.AlbumResp, error) {
+	want, other := contentPreference()
+	if want == "" || album.Attributes.ContentRating != other {
+		return nil, nil
+	}
+	match := func(candidates []ampapi.AlbumRespData) string {
+		id := ""
+		for _, c := range candidates {
+			if c.Attributes.ContentRating != want || !strings.EqualFold(discography.BaseTitle(c.Attributes.Name), discography.BaseTitle(album.Attributes.Name)) {
+				continue
+			}
+			if c.Attributes.TrackCount == album.Attributes.TrackCount {
+				return c.ID
+			}
+			if id == "" {
+				id = c.ID
+			}
+		}
+		return id
+	}
+	versions, _ := client.GetAlbumOtherVersions(album.ID)
+	id := match(versions)
+	if id == "" && len(album.Relationships.Artists.Data) > 0 {
+		albums, err := client.GetArtistAlbums(album.Relationships.Artists.Data[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		id = match(albums)
+	}
+	if id == "" {
+		return nil, nil
+	}
+	return client.GetAlbumResp(id)
+}
+
+// equivalentTrack finds track in another edition of its album by disc and track number,
+// falling back to the name when the editions are numbered differently.
+func equivalentTrack(album *ampapi.AlbumRespData, track *ampapi.TrackRespData) *ampapi.TrackRespData {
+	tracks := album.Relationships.Tracks.Data
+	for i := range tracks {
+		t := &tracks[i]
+		if t.Attributes.DiscNumber == track.Attributes.DiscNumber && t.Attributes.TrackNumber == track.Attributes.TrackNumber &&
+			strings.EqualFold(t.Attributes.Name, track.Attributes.Name) {
+			return t
+		}
+	}
+	for i := range tracks {
+		if strings.EqualFold(tracks[i].Attributes.Name, track.Attributes.Name) {
+			return &tracks[i]
+		}
+	}
+	return nil
+}
+
+// preferredAlbum applies content-preference to an album URL, returning the album to download,
+// the ID its track trackId (if any) has there and the album's response when it had to be fetched
+// (nil otherwise, for ripAlbum to fetch). Without a preferred edition the IDs are returned unchanged.
+func preferredAlbum(storefront string, albumId string, trackId string, token string) (string, string, *ampapi.AlbumResp) {
+	if want, _ := contentPreference(); want == "" {
+		return albumId, trackId, nil
+	}
+	client := ampapi.NewClient(storefront, Config.Language, token)
+	resp, err := client.GetAlbumResp(albumId)
+	if err != nil {
+		return albumId, trackId, nil
+	}
+	altResp, err := equivalentAlbum(client, &resp.Data[0])
+	if err != nil {
+		fmt.Println("Failed to look up the preferred edition:", err)
+	}
+	if altResp == nil {
+		return albumId, trackId, resp
+	}
+	alt := &altResp.Data[0]
+	if trackId != "" {
+		var newId string
+		for i, t := range resp.Data[0].Relationships.Tracks.Data {
+			if t.ID == trackId {
+				if eq := equivalentTrack(alt, &resp.Data[0].Relationships.Tracks.Data[i]); eq != nil {
+					newId = eq.ID
+				}
+			}
+		}
+		if newId == "" {
+			fmt.Println("The song is not on the preferred edition, keeping the original.")
+			return albumId, trackId, resp
+		}
+		trackId = newId
+	}
+	fmt.Printf("Using the %s edition: %s (%s)\n", alt.Attributes.ContentRating, alt.Attributes.Name, alt.ID)
+	return alt.ID, trackId, altResp
+}
+
+// preferPlaylistTracks swaps the playlist tracks rated the other way for their equivalent on
+// the preferred edition of their album.
+func preferPlaylistTracks(playlist *task.Playlist, token string) {
+	_, other := contentPreference()
+	if other == "" {
+		return
+	}
+	client := ampapi.NewClient(playlist.Storefront, Config.Language, token)
+	data := playlist.Resp.Data[0].Relationships.Tracks.Data
+	for i := range playlist.Tracks {
+		track := &playlist.Tracks[i]
+		if track.Type != "songs" || track.Resp.Attributes.ContentRating != other {
+			continue
+		}
+		resp, err := client.GetAlbumRespByHref(track.Resp.Href)
+		if err != nil {
+			continue
+		}
+		alt, err := equivalentAlbum(client, &resp.Data[0])
+		if err != nil || alt == nil {
+			continue
+		}
+		eq := equivalentTrack(&alt.Data[0], &track.Resp)
+		if eq == nil {
+			continue
+		}
+		// The album's tracks carry no relationships, which the file name and tags need.
+		eq, err = client.GetTrackResp(eq.ID)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("Using the %s version of %s\n", eq.Attributes.ContentRating, track.Name)
+		track.ID = eq.ID
+		track.Name = eq.Attributes.Name
+		track.Resp = *eq
+		track.M3u8 = eq.Attributes.ExtendedAssetUrls.EnhancedHls
+		track.WebM3u8 = eq.Attributes.ExtendedAssetUrls.EnhancedHls
+		if i < len(data) {
+			data[i] = *eq
+		}
+	}
+}
+
 func ripPlaylist(playlistId string, token string, storefront string, mediaUserToken string) error {
 	playlist := task.NewPlaylist(storefront, playlistId)
 	err := playlist.GetResp(token, Config.Language)
@@ -1455,6 +2050,7 @@ func ripPlaylist(playlistId string, token string, storefront string, mediaUserTo
 		fmt.Println("Failed to get playlist response.")
 		return err
 	}
+	preferPlaylistTracks(playlist, token)
 	meta := playlist.Resp
 	if debug_mode {
 		fmt.Println(meta.Data[0].Attributes.ArtistName)
@@ -1507,17 +2103,8 @@ func ripPlaylist(playlistId string, token string, storefront string, mediaUserTo
 		Codec = "ALAC"
 	}
 	playlist.Codec = Codec
-	var singerFoldername string
-	if Config.ArtistFolderFormat != "" {
-		singerFoldername = strings.NewReplacer(
-			"{ArtistName}", "Apple Music",
-			"{ArtistId}", "",
-			"{UrlArtistName}", "Apple Music",
-		).Replace(Config.ArtistFolderFormat)
-		if strings.HasSuffix(singerFoldername, ".") {
-			singerFoldername = strings.ReplaceAll(singerFoldername, ".", "")
-		}
-		singerFoldername = strings.TrimSpace(singerFoldername)
+	singerFoldername := renderArtistFolder("Apple Music", "")
+	if singerFoldername != "" {
 		fmt.Println(singerFoldername)
 	}
 	singerFolder := filepath.Join(Config.AlacSaveFolder, forbiddenNames.ReplaceAllString(singerFoldername, "_"))
@@ -1531,7 +2118,7 @@ func ripPlaylist(playlistId string, token string, storefront string, mediaUserTo
 	playlist.SaveDir = singerFolder
 
 	var Quality string
-	if strings.Contains(Config.AlbumFolderFormat, "Quality") {
+	if usesQuality(playlistFolderTemplate) {
 		if dl_atmos {
 			Quality = fmt.Sprintf("%dKbps", Config.AtmosMax-2000)
 		} else if dl_aac && Config.AacType == "aac-lc" {
@@ -1567,35 +2154,8 @@ func ripPlaylist(playlistId string, token string, storefront string, mediaUserTo
 			}
 		}
 	}
-	stringsToJoin := []string{}
-	if meta.Data[0].Attributes.IsAppleDigitalMaster || meta.Data[0].Attributes.IsMasteredForItunes {
-		if Config.AppleMasterChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.AppleMasterChoice)
-		}
-	}
-	if meta.Data[0].Attributes.ContentRating == "explicit" {
-		if Config.ExplicitChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.ExplicitChoice)
-		}
-	}
-	if meta.Data[0].Attributes.ContentRating == "clean" {
-		if Config.CleanChoice != "" {
-			stringsToJoin = append(stringsToJoin, Config.CleanChoice)
-		}
-	}
-	Tag_string := strings.Join(stringsToJoin, " ")
-	playlistFolder := strings.NewReplacer(
-		"{ArtistName}", "Apple Music",
-		"{PlaylistName}", LimitString(meta.Data[0].Attributes.Name),
-		"{PlaylistId}", playlistId,
-		"{Quality}", Quality,
-		"{Codec}", Codec,
-		"{Tag}", Tag_string,
-	).Replace(Config.PlaylistFolderFormat)
-	if strings.HasSuffix(playlistFolder, ".") {
-		playlistFolder = strings.ReplaceAll(playlistFolder, ".", "")
-	}
-	playlistFolder = strings.TrimSpace(playlistFolder)
+	Tag_string := tagString(meta.Data[0].Attributes.IsAppleDigitalMaster || meta.Data[0].Attributes.IsMasteredForItunes, meta.Data[0].Attributes.ContentRating)
+	playlistFolder := renderPlaylistFolder("Apple Music", meta.Data[0].Attributes.Name, playlistId, Quality, Codec, Tag_string)
 	playlistFolderPath := filepath.Join(singerFolder, forbiddenNames.ReplaceAllString(playlistFolder, "_"))
 	os.MkdirAll(playlistFolderPath, os.ModePerm)
 	playlist.SaveName = playlistFolder
@@ -1670,92 +2230,357 @@ func ripPlaylist(playlistId string, token string, storefront string, mediaUserTo
 	}
 	var selected []int
 
-	if !dl_select {
+	if !dl_select || non_interactive || len(only_tracks) > 0 {
 		selected = arr
 	} else {
 		selected = playlist.ShowSelect()
 	}
 	for i := range playlist.Tracks {
 		i++
-		if isInArray(okDict[playlistId], i) {
-			counter.Total++
-			counter.Success++
-			continue
-		}
-		if isInArray(selected, i) {
+		if isInArray(selected, i) && wantTrack(playlist.Tracks[i-1].ID) {
 			ripTrack(&playlist.Tracks[i-1], token, mediaUserToken)
 		}
 	}
+	writePlaylistFiles(playlistFolderPath, playlistFolder, meta.Data[0].Attributes.Name, playlist.Tracks)
 	return nil
 }
 
-func writeMP4Tags(track *task.Track, lrc string) error {
+// libraryTrackPath looks a playlist track up in the album library, first in the download history
+// by catalog ID or ISRC, then at the path the folder templates give for its album.
+func libraryTrackPath(track *task.Track, token string) string {
+	if e, ok := dlHistory.Find(history.Query{ID: track.ID, ISRC: track.Resp.Attributes.Isrc, Codec: track.Codec, PreType: "albums"}); ok {
+		if exists, _ := fileExists(e.Path); exists {
+			return e.Path
+		}
+	}
+	// the quality is only known once the album's stream manifest has been fetched
+	if usesQuality(albumFolderTemplate) || usesQuality(songFileTemplate) {
+		return ""
+	}
+	if track.AlbumData.ID == "" {
+		if err := track.GetAlbumData(token); err != nil {
+			return ""
+		}
+	}
+	album := &track.AlbumData
+	albumFolder := filepath.Join(saveFolder(track.Codec),
+		forbiddenNames.ReplaceAllString(artistFolderName(album), "_"),
+		forbiddenNames.ReplaceAllString(renderAlbumFolder(album, "", track.Codec), "_"))
+	isrc := track.Resp.Attributes.Isrc
+	for i, albumTrack := range album.Relationships.Tracks.Data {
+		if albumTrack.ID != track.ID && (isrc == "" || albumTrack.Attributes.Isrc != isrc) {
+			continue
+		}
+		songName := songFileName(&albumTrack, album, songNumber(&albumTrack, i+1, track.DiscTotal), "", track.Codec)
+		libraryPath := filepath.Join(trackFolder(albumFolder, &albumTrack, track.DiscTotal), forbiddenNames.ReplaceAllString(songName, "_")+".m4a")
+		if exists, _ := fileExists(libraryPath); exists {
+			return libraryPath
+		}
+	}
+	return ""
+}
+
+// dedupeTrack points a playlist track at its album library copy instead of downloading it again,
+// as configured by playlist-dedupe. It returns false when the track still has to be downloaded.
+func dedupeTrack(track *task.Track, trackPath string, token string) bool {
+	if exists, _ := fileExists(trackPath); exists {
+		return false
+	}
+	libraryPath := libraryTrackPath(track, token)
+	if libraryPath == "" {
+		return false
+	}
+	var err error
+	switch Config.PlaylistDedupe {
+	case "reference":
+		track.SavePath = libraryPath
+	case "symlink":
+		target := libraryPath
+		absLibrary, err1 := filepath.Abs(libraryPath)
+		absTrack, err2 := filepath.Abs(trackPath)
+		if err1 == nil && err2 == nil {
+			if rel, err := filepath.Rel(filepath.Dir(absTrack), absLibrary); err == nil {
+				target = rel
+			}
+		}
+		err = os.Symlink(target, trackPath)
+	case "hardlink":
+		err = os.Link(libraryPath, trackPath)
+	}
+	if err != nil {
+		fmt.Println("Failed to link album library copy, downloading instead:", err)
+		return false
+	}
+	fmt.Println("Track found in album library:", libraryPath)
+	return true
+}
+
+// playlistTrackPath finds the file a playlist entry should point to, or "" when the track is not on disk.
+// With use-songinfo-for-playlist the album library copy is preferred over the playlist folder copy.
+func playlistTrackPath(track *task.Track) string {
+	var candidates []string
+	if Config.UseSongInfoForPlaylist {
+		if e, ok := dlHistory.Find(history.Query{ID: track.ID, ISRC: track.Resp.Attributes.Isrc, Codec: track.Codec, PreType: "albums"}); ok {
+			candidates = append(candidates, e.Path)
+		}
+	}
+	candidates = append(candidates, track.SavePath)
+	if e, ok := dlHistory.Find(history.Query{ID: track.ID, Codec: track.Codec, PreID: track.PreID}); ok {
+		candidates = append(candidates, e.Path)
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if exists, _ := fileExists(c); exists {
+			return c
+		}
+	}
+	return ""
+}
+
+// writePlaylistFiles exports the playlist in its original order as configured by playlist-file-format.
+func writePlaylistFiles(playlistFolderPath string, fileName string, name string, tracks []task.Track) {
+	format := strings.ToLower(Config.PlaylistFileFormat)
+	if format == "" {
+		return
+	}
+	dir := playlistFolderPath
+	if Config.PlaylistFileFolder != "" {
+		dir = Config.PlaylistFileFolder
+		os.MkdirAll(dir, os.ModePerm)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Println("Failed to write playlist file:", err)
+		return
+	}
+	var entries []playlistfile.Entry
+	for i := range tracks {
+		trackPath := playlistTrackPath(&tracks[i])
+		if trackPath == "" {
+			continue
+		}
+		absPath, err := filepath.Abs(trackPath)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absDir, absPath)
+		if err != nil {
+			rel = absPath
+		}
+		attr := tracks[i].Resp.Attributes
+		entries = append(entries, playlistfile.Entry{
+			Path:           rel,
+			Title:          attr.Name,
+			Artist:         attr.ArtistName,
+			Album:          attr.AlbumName,
+			DurationMillis: attr.DurationInMillis,
+		})
+	}
+	base := filepath.Join(dir, forbiddenNames.ReplaceAllString(fileName, "_"))
+	if format == "m3u8" || format == "both" {
+		if err := playlistfile.WriteM3U8(base+".m3u8", name, entries); err != nil {
+			fmt.Println("Failed to write m3u8 playlist:", err)
+		}
+	}
+	if format == "xspf" || format == "both" {
+		if err := playlistfile.WriteXSPF(base+".xspf", name, entries); err != nil {
+			fmt.Println("Failed to write xspf playlist:", err)
+		}
+	}
+}
+
+// sortName drops a leading article listed in sort-articles, e.g. "The Beatles" sorts as "Beatles".
+func sortName(name string) string {
+	for _, article := range Config.SortArticles {
+		prefix := article + " "
+		if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return strings.TrimSpace(name[len(prefix):])
+		}
+	}
+	return name
+}
+
+// genreNames drops the catch-all "Music" genre the catalog appends to most releases.
+func genreNames(genres []string) []string {
+	var names []string
+	for _, genre := range genres {
+		if genre != "Music" || len(genres) == 1 {
+			names = append(names, genre)
+		}
+	}
+	return names
+}
+
+// tagFile replaces the tags of the MP4 at path with t, adding the ilst box go-mp4tag needs when the
+// file has none. A non-empty coverPath replaces the embedded pictures, otherwise they are kept;
+// a cover that cannot be read is skipped.
+func tagFile(path string, t *mp4tag.MP4Tags, coverPath string) error {
+	if err := mp4meta.EnsureIlst(path); err != nil {
+		return err
+	}
+	del := []string{"alltags"}
+	if coverPath != "" {
+		data, err := os.ReadFile(coverPath)
+		if err != nil {
+			fmt.Println("Failed to embed cover:", err)
+		} else {
+			t.Pictures = []*mp4tag.MP4Picture{{Format: mp4tag.ImageTypeAuto, Data: data}}
+			del = append(del, "allpictures")
+		}
+	}
+	mp4, err := mp4tag.Open(path)
+	if err != nil {
+		return err
+	}
+	err = mp4.Write(t, del)
+	mp4.Close()
+	return err
+}
+
+// performer is the catalog's attribution of a classical recording without the conductor (soloists
+// and orchestra) when there is one, otherwise the track artist.
+func performer(track *task.Track) string {
+	if track.Resp.Attributes.Attribution != "" {
+		if performers, _ := classicalCredits(track.Resp.Attributes.Attribution); performers != "" {
+			return performers
+		}
+	}
+	return track.Resp.Attributes.ArtistName
+}
+
+var (
+	ensemblePrefixes = []string{"orche", "orque", "philharm", "symphon", "sinfoni", "ensemble", "choir", "chor", "chœur", "coro",
+		"quartet", "quatuor", "trio", "quintet", "consort", "soloists", "players", "camerata", "academy", "akademie", "kammer", "virtuosi"}
+	ensembleSuffixes = []string{"orchester", "orchestra", "chor", "kapelle", "philharmonie", "philharmoniker"}
+)
+
+// isEnsemble guesses from its name whether an attribution entry is an orchestra, choir or other ensemble.
+func isEnsemble(name string) bool {
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		for _, p := range ensemblePrefixes {
+			if strings.HasPrefix(word, p) {
+				return true
+			}
+		}
+		for _, suffix := range ensembleSuffixes {
+			if strings.HasSuffix(word, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// classicalCredits splits a catalog attribution into the performers and the conductor. The catalog
+// gives no roles, only a list in the order soloists, ensembles, conductor, so the conductor is taken
+// to be the single name after the last ensemble; without an ensemble there is no conductor.
+func classicalCredits(attribution string) (performers string, conductor string) {
+	names := strings.Split(attribution, ", ")
+	last := -1
+	for i, name := range names {
+		if isEnsemble(name) {
+			last = i
+		}
+	}
+	if last >= 0 && last == len(names)-2 && !isEnsemble(names[last+1]) {
+		return strings.Join(names[:last+1], ", "), names[last+1]
+	}
+	return attribution, ""
+}
+
+// conductor is the conductor of a classical recording, see classicalCredits.
+func conductor(track *task.Track) string {
+	_, c := classicalCredits(track.Resp.Attributes.Attribution)
+	return c
+}
+
+// tagID converts a catalog ID for the plID and atID atoms, which go-mp4tag writes as int32. An ID
+// that does not fit is left out with a warning rather than failing the already downloaded track.
+func tagID(kind string, id string) int32 {
+	n, err := strconv.ParseInt(id, 10, 32)
+	if err != nil || n < 0 {
+		fmt.Printf("\u26A0 %s ID %s does not fit the MP4 tag, leaving it out\n", kind, id)
+		return 0
+	}
+	return int32(n)
+}
+
+// buildMP4Tags returns what writeMP4Tags stores for track: the go-mp4tag fields and the ilst items
+// go-mp4tag does not know about.
+func buildMP4Tags(track *task.Track, lrc string) (*mp4tag.MP4Tags, []mp4meta.Item) {
+	genres := genreNames(track.Resp.Attributes.GenreNames)
 	t := &mp4tag.MP4Tags{
 		Title:      track.Resp.Attributes.Name,
-		TitleSort:  track.Resp.Attributes.Name,
+		TitleSort:  sortName(track.Resp.Attributes.Name),
 		Artist:     track.Resp.Attributes.ArtistName,
-		ArtistSort: track.Resp.Attributes.ArtistName,
+		ArtistSort: sortName(track.Resp.Attributes.ArtistName),
 		Custom: map[string]string{
-			"PERFORMER":   track.Resp.Attributes.ArtistName,
+			"PERFORMER":   performer(track),
 			"RELEASETIME": track.Resp.Attributes.ReleaseDate,
 			"ISRC":        track.Resp.Attributes.Isrc,
 			"LABEL":       "",
 			"UPC":         "",
 		},
 		Composer:     track.Resp.Attributes.ComposerName,
-		ComposerSort: track.Resp.Attributes.ComposerName,
-		CustomGenre:  track.Resp.Attributes.GenreNames[0],
+		ComposerSort: sortName(track.Resp.Attributes.ComposerName),
+		Conductor:    conductor(track),
 		Lyrics:       lrc,
 		TrackNumber:  int16(track.Resp.Attributes.TrackNumber),
 		DiscNumber:   int16(track.Resp.Attributes.DiscNumber),
 		Album:        track.Resp.Attributes.AlbumName,
-		AlbumSort:    track.Resp.Attributes.AlbumName,
+		AlbumSort:    sortName(track.Resp.Attributes.AlbumName),
+		Date:         track.Resp.Attributes.ReleaseDate,
 	}
 
+	// the album the tags describe, if any; for playlists without song info it is the playlist itself
+	var album *ampapi.AlbumRespData
+	if track.PreType == "albums" || Config.UseSongInfoForPlaylist {
+		album = &track.AlbumData
+	}
+	albumID := ""
 	if track.PreType == "albums" {
-		albumID, err := strconv.ParseUint(track.PreID, 10, 32)
-		if err != nil {
-			return err
-		}
-		t.ItunesAlbumID = int32(albumID)
+		albumID = track.PreID
+	} else if album != nil {
+		albumID = album.ID
+	}
+	// plID is the numeric album ID; playlist IDs (pl.…) are not numbers and go in a freeform atom
+	if albumID != "" {
+		t.ItunesAlbumID = tagID("album", albumID)
+	}
+	if track.PreType == "playlists" {
+		t.Custom["PLAYLISTID"] = track.PreID
 	}
 
 	if len(track.Resp.Relationships.Artists.Data) > 0 {
-		artistID, err := strconv.ParseUint(track.Resp.Relationships.Artists.Data[0].ID, 10, 32)
-		if err != nil {
-			return err
-		}
-		t.ItunesArtistID = int32(artistID)
+		t.ItunesArtistID = tagID("artist", track.Resp.Relationships.Artists.Data[0].ID)
 	}
 
-	if (track.PreType == "playlists" || track.PreType == "stations") && !Config.UseSongInfoForPlaylist {
+	if album == nil {
 		t.DiscNumber = 1
 		t.DiscTotal = 1
 		t.TrackNumber = int16(track.TaskNum)
 		t.TrackTotal = int16(track.TaskTotal)
 		t.Album = track.PlaylistData.Attributes.Name
-		t.AlbumSort = track.PlaylistData.Attributes.Name
+		t.AlbumSort = sortName(track.PlaylistData.Attributes.Name)
 		t.AlbumArtist = track.PlaylistData.Attributes.ArtistName
-		t.AlbumArtistSort = track.PlaylistData.Attributes.ArtistName
-	} else if (track.PreType == "playlists" || track.PreType == "stations") && Config.UseSongInfoForPlaylist {
-		t.DiscTotal = int16(track.DiscTotal)
-		t.TrackTotal = int16(track.AlbumData.Attributes.TrackCount)
-		t.AlbumArtist = track.AlbumData.Attributes.ArtistName
-		t.AlbumArtistSort = track.AlbumData.Attributes.ArtistName
-		t.Custom["UPC"] = track.AlbumData.Attributes.Upc
-		t.Custom["LABEL"] = track.AlbumData.Attributes.RecordLabel
-		t.Date = track.AlbumData.Attributes.ReleaseDate
-		t.Copyright = track.AlbumData.Attributes.Copyright
-		t.Publisher = track.AlbumData.Attributes.RecordLabel
+		t.AlbumArtistSort = sortName(track.PlaylistData.Attributes.ArtistName)
+		if len(track.Resp.Relationships.Albums.Data) > 0 {
+			t.Custom["UPC"] = track.Resp.Relationships.Albums.Data[0].Attributes.Upc
+		}
 	} else {
 		t.DiscTotal = int16(track.DiscTotal)
-		t.TrackTotal = int16(track.AlbumData.Attributes.TrackCount)
-		t.AlbumArtist = track.AlbumData.Attributes.ArtistName
-		t.AlbumArtistSort = track.AlbumData.Attributes.ArtistName
-		t.Custom["UPC"] = track.AlbumData.Attributes.Upc
-		t.Date = track.AlbumData.Attributes.ReleaseDate
-		t.Copyright = track.AlbumData.Attributes.Copyright
-		t.Publisher = track.AlbumData.Attributes.RecordLabel
+		t.TrackTotal = int16(album.Attributes.TrackCount)
+		t.AlbumArtist = albumArtistName(album.Attributes.ArtistName, album.Attributes.IsCompilation)
+		t.AlbumArtistSort = sortName(t.AlbumArtist)
+		t.Custom["UPC"] = album.Attributes.Upc
+		t.Custom["LABEL"] = album.Attributes.RecordLabel
+		if album.Attributes.ReleaseDate != "" {
+			t.Date = album.Attributes.ReleaseDate
+		}
+		t.Copyright = album.Attributes.Copyright
+		t.Publisher = album.Attributes.RecordLabel
 	}
 
 	if track.Resp.Attributes.ContentRating == "explicit" {
@@ -1766,207 +2591,1415 @@ func writeMP4Tags(track *task.Track, lrc string) error {
 		t.ItunesAdvisory = mp4tag.ItunesAdvisoryNone
 	}
 
-	mp4, err := mp4tag.Open(track.SavePath)
+	// go-mp4tag has no fields for these and drops atoms it does not know on write
+	items := []mp4meta.Item{
+		mp4meta.TextList("©gen", genres),
+		mp4meta.Text("purd", time.Now().UTC().Format("2006-01-02 15:04:05")),
+		mp4meta.Flag("cpil", album != nil && album.Attributes.IsCompilation),
+		// album tracks are meant to be played in order, singles have nothing to be gapless with
+		mp4meta.Flag("pgap", album != nil && album.Attributes.TrackCount > 1),
+	}
+	if id, err := strconv.ParseUint(track.ID, 10, 32); err == nil {
+		items = append(items, mp4meta.Int("cnID", int64(id), 4))
+	}
+	// classical work and movement, shown by players instead of the track title when shwm is set
+	attrs := &track.Resp.Attributes
+	items = append(items,
+		mp4meta.Text("©wrk", attrs.WorkName),
+		mp4meta.Text("©mvn", attrs.MovementName),
+		mp4meta.Int("©mvi", int64(attrs.MovementNumber), 2),
+		mp4meta.Int("©mvc", int64(attrs.MovementCount), 2),
+		mp4meta.Flag("shwm", attrs.WorkName != "" && attrs.MovementName != ""),
+	)
+	return t, items
+}
+
+// subtitleFormat reports whether lrc-format is one of the subtitle formats, which are only
+// written to lyrics files; the lyrics embedded in the track stay LRC.
+func subtitleFormat(format string) bool {
+	return format == "srt" || format == "vtt" || format == "ass"
+}
+
+// trackLyrics fetches the lyrics of a track and returns them in lrc-format for the lyrics file
+// and in the format they are embedded in.
+func trackLyrics(track *task.Track, token string, mediaUserToken string) (string, string, error) {
+	opts := lyrics.Options{
+		SubtitleTranslation:     Config.SubtitleTranslation,
+		SubtitleTransliteration: Config.SubtitleTransliteration,
+		AgentMarker:             Config.LyricsAgentMarker,
+		BackgroundVocals:        Config.LyricsBackgroundVocals,
+		TranslationLanguage:     Config.TranslationLanguage,
+		LRCLines:                Config.LrcLines,
+		LRCSeparator:            Config.LrcSeparator,
+	}
+	ttml, err := lyrics.Get(track.Storefront, track.ID, Config.LrcType, Config.Language, "ttml", token, mediaUserToken, opts)
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	defer mp4.Close()
-	err = mp4.Write(t, []string{})
-	if err != nil {
-		return err
+	embedFormat := Config.LrcFormat
+	if subtitleFormat(embedFormat) {
+		embedFormat = "lrc"
 	}
-	return nil
+	embed, err := lyrics.Convert(ttml, embedFormat, opts)
+	if err != nil || embedFormat == Config.LrcFormat {
+		return embed, embed, err
+	}
+	file, err := lyrics.Convert(ttml, Config.LrcFormat, opts)
+	return file, embed, err
 }
 
-func main() {
-	err := loadConfig()
-	if err != nil {
-		fmt.Printf("load Config failed: %v", err)
-		return
-	}
-	token, err := ampapi.GetToken()
-	if err != nil {
-		if Config.AuthorizationToken != "" && Config.AuthorizationToken != "your-authorization-token" {
-			token = strings.Replace(Config.AuthorizationToken, "Bearer ", "", -1)
-		} else {
-			fmt.Println("Failed to get token.")
-			return
+func writeMP4Tags(track *task.Track, lrc string) error {
+	t, items := buildMP4Tags(track, lrc)
+	// a retagged file keeps the date it was first downloaded
+	if old, err := mp4meta.Items(track.SavePath); err == nil {
+		if purd, ok := old["purd"]; ok {
+			for i := range items {
+				if items[i].Name == "purd" {
+					items[i] = purd
+				}
+			}
 		}
 	}
-	var search_type string
-	pflag.StringVar(&search_type, "search", "", "Search for 'album', 'song', or 'artist'. Provide query after flags.")
-	pflag.BoolVar(&dl_atmos, "atmos", false, "Enable atmos download mode")
-	pflag.BoolVar(&dl_aac, "aac", false, "Enable adm-aac download mode")
-	pflag.BoolVar(&dl_select, "select", false, "Enable selective download")
-	pflag.BoolVar(&dl_song, "song", false, "Enable single song download mode")
-	pflag.BoolVar(&artist_select, "all-album", false, "Download all artist albums")
-	pflag.BoolVar(&debug_mode, "debug", false, "Enable debug mode to show audio quality information")
-	alac_max = pflag.Int("alac-max", Config.AlacMax, "Specify the max quality for download alac")
-	atmos_max = pflag.Int("atmos-max", Config.AtmosMax, "Specify the max quality for download atmos")
-	aac_type = pflag.String("aac-type", Config.AacType, "Select AAC type, aac aac-binaural aac-downmix")
-	mv_audio_type = pflag.String("mv-audio-type", Config.MVAudioType, "Select MV audio type, atmos ac3 aac")
-	mv_max = pflag.Int("mv-max", Config.MVMax, "Specify the max quality for download MV")
+	coverPath := ""
+	if Config.EmbedCover {
+		coverPath = track.CoverPath
+	}
+	if err := tagFile(track.SavePath, t, coverPath); err != nil {
+		return err
+	}
+	return mp4meta.Set(track.SavePath, items...)
+}
 
-	pflag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] [url1 url2 ...]\n", "[main | main.exe | go run main.go]")
-		fmt.Fprintf(os.Stderr, "Search Usage: %s --search [album|song|artist] [query]\n", "[main | main.exe | go run main.go]")
-		fmt.Println("\nOptions:")
-		pflag.PrintDefaults()
+// dlOptions is the part of the command-line state that a line of --input-file may override.
+type dlOptions struct {
+	atmos, aac, song, selectTracks, allAlbum bool
+	alacMax, atmosMax, mvMax                 int
+	aacType, mvAudioType                     string
+	albumTypes                               []string
+	preferRating, releaseYears, nameFilter   string
+	collapseEditions                         bool
+	urlArtistName, urlArtistID               string
+	onlyTracks                               []string
+}
+
+func currentOptions() dlOptions {
+	return dlOptions{
+		atmos:            dl_atmos,
+		aac:              dl_aac,
+		song:             dl_song,
+		selectTracks:     dl_select,
+		allAlbum:         artist_select,
+		alacMax:          Config.AlacMax,
+		atmosMax:         Config.AtmosMax,
+		mvMax:            Config.MVMax,
+		aacType:          Config.AacType,
+		mvAudioType:      Config.MVAudioType,
+		albumTypes:       album_types,
+		preferRating:     prefer_rating,
+		releaseYears:     release_years,
+		nameFilter:       name_filter,
+		collapseEditions: collapse_editions,
+		urlArtistName:    url_artist_name,
+		urlArtistID:      url_artist_id,
+		onlyTracks:       only_tracks,
 	}
+}
 
-	pflag.Parse()
-	Config.AlacMax = *alac_max
-	Config.AtmosMax = *atmos_max
-	Config.AacType = *aac_type
-	Config.MVAudioType = *mv_audio_type
-	Config.MVMax = *mv_max
+func (o dlOptions) apply() {
+	dl_atmos = o.atmos
+	dl_aac = o.aac
+	dl_song = o.song
+	dl_select = o.selectTracks
+	artist_select = o.allAlbum
+	Config.AlacMax = o.alacMax
+	Config.AtmosMax = o.atmosMax
+	Config.MVMax = o.mvMax
+	Config.AacType = o.aacType
+	Config.MVAudioType = o.mvAudioType
+	album_types = o.albumTypes
+	prefer_rating = o.preferRating
+	release_years = o.releaseYears
+	name_filter = o.nameFilter
+	collapse_editions = o.collapseEditions
+	url_artist_name = o.urlArtistName
+	url_artist_id = o.urlArtistID
+	only_tracks = o.onlyTracks
+}
 
-	args := pflag.Args()
+// wantTrack reports whether a track belongs to the current queue item; items re-queued
+// from a report only carry the tracks that failed.
+func wantTrack(id string) bool {
+	return len(only_tracks) == 0 || contains(only_tracks, id)
+}
 
-	if search_type != "" {
-		if len(args) == 0 {
-			fmt.Println("Error: --search flag requires a query.")
-			pflag.Usage()
-			return
-		}
-		selectedUrl, err := handleSearch(search_type, args, token)
-		if err != nil {
-			fmt.Printf("\nSearch process failed: %v\n", err)
-			return
-		}
-		if selectedUrl == "" {
-			fmt.Println("\nExiting.")
-			return
-		}
-		os.Args = []string{selectedUrl}
-	} else {
-		if len(args) == 0 {
-			fmt.Println("No URLs provided. Please provide at least one URL.")
-			pflag.Usage()
-			return
-		}
-		os.Args = args
-	}
+// flagSet binds the per-line options, using the current values of o as defaults.
+func (o *dlOptions) flagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("input-file", pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&o.atmos, "atmos", o.atmos, "")
+	fs.BoolVar(&o.aac, "aac", o.aac, "")
+	fs.BoolVar(&o.song, "song", o.song, "")
+	fs.BoolVar(&o.selectTracks, "select", o.selectTracks, "")
+	fs.BoolVar(&o.allAlbum, "all-album", o.allAlbum, "")
+	fs.IntVar(&o.alacMax, "alac-max", o.alacMax, "")
+	fs.IntVar(&o.atmosMax, "atmos-max", o.atmosMax, "")
+	fs.IntVar(&o.mvMax, "mv-max", o.mvMax, "")
+	fs.StringVar(&o.aacType, "aac-type", o.aacType, "")
+	fs.StringVar(&o.mvAudioType, "mv-audio-type", o.mvAudioType, "")
+	fs.StringSliceVar(&o.albumTypes, "album-type", o.albumTypes, "")
+	fs.StringVar(&o.preferRating, "prefer-rating", o.preferRating, "")
+	fs.StringVar(&o.releaseYears, "years", o.releaseYears, "")
+	fs.StringVar(&o.nameFilter, "name-filter", o.nameFilter, "")
+	fs.BoolVar(&o.collapseEditions, "collapse-editions", o.collapseEditions, "")
+	return fs
+}
 
-	if strings.Contains(os.Args[0], "/artist/") {
-		urlArtistName, urlArtistID, err := getUrlArtistName(os.Args[0], token)
-		if err != nil {
-			fmt.Println("Failed to get artistname.")
-			return
-		}
-		Config.ArtistFolderFormat = strings.NewReplacer(
-			"{UrlArtistName}", LimitString(urlArtistName),
-			"{ArtistId}", urlArtistID,
-		).Replace(Config.ArtistFolderFormat)
-		albumArgs, err := checkArtist(os.Args[0], token, "albums")
+// queueItem is one URL waiting to be downloaded.
+type queueItem struct {
+	URL        string
+	Options    []string // per-line flags from --input-file
+	ArtistName string   // artist page the URL was expanded from, for {UrlArtistName}
+	ArtistID   string   // and {ArtistId}
+	TrackIDs   []string // limit the URL to these tracks, e.g. when retrying failures
+}
+
+// options returns the current options with the item's overrides applied.
+func (item queueItem) options() (dlOptions, error) {
+	o := currentOptions()
+	if item.ArtistName != "" {
+		o.urlArtistName = item.ArtistName
+		o.urlArtistID = item.ArtistID
+	}
+	o.onlyTracks = item.TrackIDs
+	if len(item.Options) == 0 {
+		return o, nil
+	}
+	fs := o.flagSet()
+	if err := fs.Parse(item.Options); err != nil {
+		return o, err
+	}
+	if fs.NArg() > 0 {
+		return o, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return o, nil
+}
+
+func isSupportedUrl(u string) bool {
+	for _, check := range []func(string) (string, string){checkUrl, checkUrlMv, checkUrlSong, checkUrlPlaylist, checkUrlStation, checkUrlArtist} {
+		if _, id := check(u); id != "" {
+			return true
+		}
+	}
+	return false
+}
+
+var inputFileComment = regexp.MustCompile(`(^|\s)#.*$`)
+
+// readInputFile reads one URL per line. Blank lines and anything after a '#' that starts a word are ignored,
+// and a line may carry its own options, e.g. "--atmos https://music.apple.com/us/album/...".
+func readInputFile(path string) ([]queueItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var items []queueItem
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(inputFileComment.ReplaceAllString(scanner.Text(), ""))
+		if len(fields) == 0 {
+			continue
+		}
+		o := currentOptions()
+		fs := o.flagSet()
+		if err := fs.Parse(fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if fs.NArg() != 1 {
+			return nil, fmt.Errorf("line %d: expected exactly one URL, got %d", lineNum, fs.NArg())
+		}
+		item := queueItem{URL: fs.Arg(0)}
+		if !isSupportedUrl(item.URL) {
+			return nil, fmt.Errorf("line %d: unsupported URL %s", lineNum, item.URL)
+		}
+		for _, field := range fields {
+			if field != item.URL {
+				item.Options = append(item.Options, field)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+// failedQueue re-queues the URLs of r that failed outright and, for every other URL,
+// only its tracks whose outcome was error or unavailable.
+func failedQueue(r *report.Report) []queueItem {
+	var queue []queueItem
+	for _, item := range r.Items {
+		q := queueItem{URL: item.URL, Options: item.Options, ArtistName: item.ArtistName, ArtistID: item.ArtistID}
+		if item.Error == "" {
+			for _, t := range item.Tracks {
+				if t.Failed() {
+					q.TrackIDs = append(q.TrackIDs, t.ID)
+				}
+			}
+			if len(q.TrackIDs) == 0 {
+				continue
+			}
+		}
+		queue = append(queue, q)
+	}
+	return queue
+}
+
+// expandArtists replaces every artist URL in the queue with the albums and music videos picked from it.
+func expandArtists(queue []queueItem, token string) ([]queueItem, error) {
+	var expanded []queueItem
+	for _, item := range queue {
+		if !strings.Contains(item.URL, "/artist/") {
+			expanded = append(expanded, item)
+			continue
+		}
+		opts, err := item.options()
 		if err != nil {
-			fmt.Println("Failed to get artist albums.")
-			return
+			return nil, fmt.Errorf("invalid options for %s: %w", item.URL, err)
 		}
-		mvArgs, err := checkArtist(os.Args[0], token, "music-videos")
+		saved := currentOptions()
+		opts.apply()
+		urls, err := artistUrls(item.URL, token)
+		artistName, artistID := url_artist_name, url_artist_id
+		saved.apply()
 		if err != nil {
-			fmt.Println("Failed to get artist music-videos.")
+			return nil, err
+		}
+		for _, u := range urls {
+			expanded = append(expanded, queueItem{URL: u, Options: item.Options, ArtistName: artistName, ArtistID: artistID})
 		}
-		os.Args = append(albumArgs, mvArgs...)
 	}
-	albumTotal := len(os.Args)
-	for {
-		for albumNum, urlRaw := range os.Args {
-			fmt.Printf("Queue %d of %d: ", albumNum+1, albumTotal)
-			var storefront, albumId string
+	return expanded, nil
+}
 
-			if strings.Contains(urlRaw, "/music-video/") {
-				fmt.Println("Music Video")
-				if debug_mode {
-					continue
-				}
-				counter.Total++
-				if len(Config.MediaUserToken) <= 50 {
-					fmt.Println(": meida-user-token is not set, skip MV dl")
-					counter.Success++
-					continue
-				}
-				if _, err := exec.LookPath("mp4decrypt"); err != nil {
-					fmt.Println(": mp4decrypt is not found, skip MV dl")
-					counter.Success++
-					continue
-				}
-				mvSaveDir := strings.NewReplacer(
-					"{ArtistName}", "",
-					"{UrlArtistName}", "",
-					"{ArtistId}", "",
-				).Replace(Config.ArtistFolderFormat)
-				if mvSaveDir != "" {
-					mvSaveDir = filepath.Join(Config.AlacSaveFolder, forbiddenNames.ReplaceAllString(mvSaveDir, "_"))
-				} else {
-					mvSaveDir = Config.AlacSaveFolder
-				}
-				storefront, albumId = checkUrlMv(urlRaw)
-				err := mvDownloader(albumId, mvSaveDir, token, storefront, Config.MediaUserToken, nil)
-				if err != nil {
-					fmt.Println("\u26A0 Failed to dl MV:", err)
-					counter.Error++
-					continue
-				}
-				counter.Success++
+// artistUrls sets the artist used for {UrlArtistName} and {ArtistId} and returns the selected album and MV URLs.
+func artistUrls(artistUrl string, token string) ([]string, error) {
+	if _, err := discographyFilter(); err != nil {
+		return nil, err
+	}
+	urlArtistName, urlArtistID, err := getUrlArtistName(artistUrl, token)
+	if err != nil {
+		return nil, errors.New("Failed to get artistname.")
+	}
+	url_artist_name = LimitString(urlArtistName)
+	url_artist_id = urlArtistID
+	albumArgs, err := checkArtist(artistUrl, token, "albums")
+	if err != nil {
+		return nil, errors.New("Failed to get artist albums.")
+	}
+	mvArgs, err := checkArtist(artistUrl, token, "music-videos")
+	if err != nil {
+		fmt.Println("Failed to get artist music-videos.")
+	}
+	return append(albumArgs, mvArgs...), nil
+}
+
+// retagFields are the go-mp4tag fields writeMP4Tags sets and go-mp4tag reads back.
+var retagFields = []string{"Title", "Artist", "AlbumArtist", "Album", "Composer", "TrackNumber", "TrackTotal", "DiscNumber",
+	"DiscTotal", "Date", "Copyright", "Publisher", "Conductor", "ItunesAdvisory", "ItunesAlbumID", "ItunesArtistID"}
+
+// sortAtoms are the sort fields go-mp4tag writes but does not read, by the atom they are stored in.
+var sortAtoms = []struct{ field, atom string }{
+	{"TitleSort", "sonm"}, {"ArtistSort", "soar"}, {"AlbumArtistSort", "soaa"}, {"AlbumSort", "soal"}, {"ComposerSort", "soco"},
+}
+
+// retagFile is one .m4a as found on disk.
+type retagFile struct {
+	path  string
+	tags  *mp4tag.MP4Tags
+	items map[string]mp4meta.Item
+}
+
+// retagger re-reads the catalog for files of the library and rewrites their tags.
+type retagger struct {
+	token, mediaUserToken string
+	dryRun                bool
+	coverDir              string
+	albums                map[string]*task.Album
+	retagged, unchanged   int
+	failed                int
+}
+
+func runRetag(args []string, token string) int {
+	flags := pflag.NewFlagSet("retag", pflag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Show the tag changes without writing anything")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s retag [--dry-run] [folder ...]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintln(os.Stderr, "Rewrites tags, cover and lyrics of the .m4a files under the folders (default: the save folders) from the catalog.")
+		fmt.Println("\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	folders := flags.Args()
+	if len(folders) == 0 {
+		for _, folder := range []string{Config.AlacSaveFolder, Config.AtmosSaveFolder, Config.AacSaveFolder} {
+			if folder != "" && !contains(folders, folder) {
+				folders = append(folders, folder)
+			}
+		}
+	}
+	coverDir, err := os.MkdirTemp("", "amd-retag-*")
+	if err != nil {
+		fmt.Println("Failed to create cover folder:", err)
+		return 1
+	}
+	defer os.RemoveAll(coverDir)
+	r := &retagger{token: token, mediaUserToken: Config.MediaUserToken, dryRun: *dryRun, coverDir: coverDir, albums: map[string]*task.Album{}}
+	for _, folder := range folders {
+		err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".m4a") {
+				r.retag(path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Failed to walk folder:", err)
+			r.failed++
+		}
+	}
+	verb := "Retagged"
+	if r.dryRun {
+		verb = "Would retag"
+	}
+	fmt.Printf("=======  %s: %d  |  Unchanged: %d  |  [\u2716 ] Errors: %d  =======\n", verb, r.retagged, r.unchanged, r.failed)
+	if r.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (r *retagger) retag(path string) {
+	changes, err := r.retagPath(path)
+	if err != nil {
+		fmt.Printf("\u26A0 %s: %v\n", path, err)
+		r.failed++
+		return
+	}
+	if len(changes) == 0 {
+		r.unchanged++
+		return
+	}
+	fmt.Println(path)
+	for _, change := range changes {
+		fmt.Println("  " + change)
+	}
+	r.retagged++
+}
+
+// retagPath rewrites the tags of one file and returns what changed.
+func (r *retagger) retagPath(path string) ([]string, error) {
+	file, err := readRetagFile(path)
+	if err != nil {
+		return nil, err
+	}
+	track, err := r.catalogTrack(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// lyrics that cannot be fetched are kept rather than removed
+	lrc := ""
+	if Config.EmbedLrc || Config.SaveLrcFile {
+		lrcStr, lrcEmbed, err := trackLyrics(track, r.token, r.mediaUserToken)
+		if err != nil && lrcEmbed == "" {
+			lrcEmbed = file.tags.Lyrics
+			if !subtitleFormat(Config.LrcFormat) {
+				lrcStr = lrcEmbed
+			}
+		}
+		if Config.SaveLrcFile && lrcStr != "" && !r.dryRun {
+			lrcFilename := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "." + Config.LrcFormat
+			if err := writeLyrics(track.SaveDir, lrcFilename, lrcStr); err != nil {
+				fmt.Println("Failed to write lyrics:", err)
+			}
+		}
+		if Config.EmbedLrc {
+			lrc = lrcEmbed
+		}
+	}
+
+	if Config.EmbedCover {
+		track.CoverPath = r.cover(track)
+	}
+
+	t, items := buildMP4Tags(track, lrc)
+	changes := file.changes(t, items)
+	if track.CoverPath != "" {
+		if cover, err := os.ReadFile(track.CoverPath); err == nil {
+			if len(file.tags.Pictures) == 0 || !bytes.Equal(file.tags.Pictures[0].Data, cover) {
+				changes = append(changes, fmt.Sprintf("cover: %s", coverChange(file.tags.Pictures, cover)))
+			}
+		}
+	}
+	if len(changes) == 0 || r.dryRun {
+		return changes, nil
+	}
+	return changes, writeMP4Tags(track, lrc)
+}
+
+func readRetagFile(path string) (*retagFile, error) {
+	mp4, err := mp4tag.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := mp4.Read()
+	mp4.Close()
+	if err != nil {
+		return nil, err
+	}
+	items, err := mp4meta.Items(path)
+	if err != nil {
+		return nil, err
+	}
+	return &retagFile{path: path, tags: tags, items: items}, nil
+}
+
+// catalogID returns the cnID of the file, or "" when it has none.
+func (file *retagFile) catalogID() string {
+	if cnID, ok := file.items["cnID"]; ok && len(cnID.Values) > 0 && len(cnID.Values[0]) == 4 {
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint32(cnID.Values[0])), 10)
+	}
+	return ""
+}
+
+// catalogTrack identifies the file by its cnID, or its ISRC for files without one, and returns the
+// track the way ripAlbum or ripPlaylist would have built it.
+func (r *retagger) catalogTrack(file *retagFile) (*task.Track, error) {
+	id := file.catalogID()
+	albumID := ""
+	if file.tags.ItunesAlbumID != 0 {
+		albumID = strconv.FormatUint(uint64(uint32(file.tags.ItunesAlbumID)), 10)
+	}
+	if id == "" || albumID == "" {
+		var song *ampapi.SongResp
+		var err error
+		if id != "" {
+			song, err = ampapi.GetSongResp(Config.Storefront, id, Config.Language, r.token)
+		} else if isrc := file.tags.Custom["ISRC"]; isrc != "" {
+			song, err = ampapi.GetSongsByIsrc(Config.Storefront, isrc, Config.Language, r.token)
+		} else {
+			return nil, errors.New("no catalog ID or ISRC in tags")
+		}
+		if err != nil {
+			return nil, err
+		}
+		id = song.Data[0].ID
+		if len(song.Data[0].Relationships.Albums.Data) == 0 {
+			return nil, fmt.Errorf("no album for song %s", id)
+		}
+		albumID = song.Data[0].Relationships.Albums.Data[0].ID
+	}
+
+	album, ok := r.albums[albumID]
+	if !ok {
+		album = task.NewAlbum(Config.Storefront, albumID)
+		if err := album.GetResp(r.token, Config.Language); err != nil {
+			return nil, err
+		}
+		r.albums[albumID] = album
+	}
+	for _, t := range album.Tracks {
+		if t.ID != id {
+			continue
+		}
+		track := t
+		track.SavePath = file.path
+		track.SaveDir = filepath.Dir(file.path)
+		// files tagged from a playlist carry the playlist as album and no plID
+		if file.tags.ItunesAlbumID == 0 && file.tags.Album != "" && file.tags.Album != album.Name {
+			track.PreType = "playlists"
+			track.PreID = file.tags.Custom["PLAYLISTID"]
+			track.PlaylistData.Attributes.Name = file.tags.Album
+			track.PlaylistData.Attributes.ArtistName = file.tags.AlbumArtist
+			track.TaskNum = int(file.tags.TrackNumber)
+			track.TaskTotal = int(file.tags.TrackTotal)
+		}
+		return &track, nil
+	}
+	return nil, fmt.Errorf("track %s not found on album %s", id, albumID)
+}
+
+// cover downloads the cover writeMP4Tags would embed for track once per run, or returns ""
+// to keep the embedded one (playlist covers are not known to retag).
+func (r *retagger) cover(track *task.Track) string {
+	name, url := track.PreID, track.AlbumData.Attributes.Artwork.URL
+	if track.PreType == "playlists" && !Config.UseSongInfoForPlaylist {
+		if !Config.DlAlbumcoverForPlaylist {
+			return ""
+		}
+		name, url = track.ID, track.Resp.Attributes.Artwork.URL
+	} else if track.PreType == "playlists" {
+		name = track.AlbumData.ID
+	}
+	if url == "" {
+		return ""
+	}
+	path, err := writeCover(r.coverDir, name, url)
+	if err != nil {
+		fmt.Println("Failed to write cover:", err)
+		return ""
+	}
+	return path
+}
+
+// changes lists the tags of the file that differ from t and items, skipping the purchase date.
+func (file *retagFile) changes(t *mp4tag.MP4Tags, items []mp4meta.Item) []string {
+	var changes []string
+	oldValue, newValue := reflect.ValueOf(file.tags).Elem(), reflect.ValueOf(t).Elem()
+	for _, field := range retagFields {
+		a, b := oldValue.FieldByName(field).Interface(), newValue.FieldByName(field).Interface()
+		if a != b {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", field, fmt.Sprint(a), fmt.Sprint(b)))
+		}
+	}
+	for _, s := range sortAtoms {
+		a, b := itemString(file.items[s.atom]), newValue.FieldByName(s.field).String()
+		if a != b {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", s.field, a, b))
+		}
+	}
+	if file.tags.Lyrics != t.Lyrics {
+		changes = append(changes, fmt.Sprintf("Lyrics: %d -> %d lines", lineCount(file.tags.Lyrics), lineCount(t.Lyrics)))
+	}
+	var keys []string
+	for k := range file.tags.Custom {
+		keys = append(keys, k)
+	}
+	for k := range t.Custom {
+		if _, ok := file.tags.Custom[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if a, b := file.tags.Custom[k], t.Custom[k]; a != b {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", k, a, b))
+		}
+	}
+	for _, item := range items {
+		if item.Name == "purd" {
+			continue
+		}
+		if a, b := itemString(file.items[item.Name]), itemString(item); a != b {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", item.Name, a, b))
+		}
+	}
+	return changes
+}
+
+// itemString renders the values of an ilst item for the dry-run diff.
+func itemString(item mp4meta.Item) string {
+	var values []string
+	for _, v := range item.Values {
+		if item.Type == mp4meta.TypeInteger || item.Type == mp4meta.TypeImplicit {
+			n := uint64(0)
+			for _, b := range v {
+				n = n<<8 | uint64(b)
+			}
+			values = append(values, strconv.FormatUint(n, 10))
+		} else {
+			values = append(values, string(v))
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+func lineCount(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimRight(s, "\n"), "\n") + 1
+}
+
+func coverChange(old []*mp4tag.MP4Picture, cover []byte) string {
+	if len(old) == 0 {
+		return fmt.Sprintf("none -> %d KB", len(cover)/1024)
+	}
+	return fmt.Sprintf("%d KB -> %d KB", len(old[0].Data)/1024, len(cover)/1024)
+}
+
+// auditFile is one .m4a found under a save folder.
+type auditFile struct {
+	path, id, isrc, album string
+	albumID               int32
+}
+
+// auditAlbum is an album folder: the files of one album below one folder, disc and work subfolders included.
+type auditAlbum struct {
+	folder, codec string
+	album         *task.Album
+	files         []auditFile
+}
+
+func runAudit(args []string, token string) int {
+	flags := pflag.NewFlagSet("audit", pflag.ExitOnError)
+	enqueue := flags.Bool("enqueue", false, "Download the missing tracks after the audit")
+	flags.BoolVar(&non_interactive, "non-interactive", false, "Never prompt while downloading the missing tracks")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s audit [--enqueue] [--non-interactive]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintln(os.Stderr, "Compares the album folders of the save folders with the catalog track lists.")
+		fmt.Println("\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var albums []*auditAlbum
+	roots := map[string]bool{}
+	failed := 0
+	for _, codec := range []string{"ALAC", "ATMOS", "AAC"} {
+		root := saveFolder(codec)
+		if root == "" || roots[root] {
+			continue
+		}
+		roots[root] = true
+		found, err := auditFolders(root, codec, token)
+		if err != nil {
+			fmt.Println("Failed to scan save folder:", err)
+			failed++
+		}
+		albums = append(albums, found...)
+	}
+
+	var queue []queueItem
+	problems := 0
+	for _, a := range albums {
+		missing, findings := a.audit()
+		if len(findings) == 0 {
+			continue
+		}
+		problems++
+		fmt.Printf("%s (album %s: %s)\n", a.folder, a.album.ID, a.album.Name)
+		for _, finding := range findings {
+			fmt.Println("  " + finding)
+		}
+		if len(missing) > 0 {
+			item := queueItem{URL: fmt.Sprintf("https://music.apple.com/%s/album/%s", a.album.Storefront, a.album.ID), TrackIDs: missing}
+			if a.codec == "ATMOS" {
+				item.Options = []string{"--atmos"}
+			} else if a.codec == "AAC" {
+				item.Options = []string{"--aac"}
+			}
+			queue = append(queue, item)
+		}
+	}
+	if usesQuality(songFileTemplate) {
+		fmt.Println("song-file-format uses the quality, file names were not checked.")
+	}
+	fmt.Printf("=======  Albums: %d  |  With problems: %d  |  [\u2716 ] Errors: %d  =======\n", len(albums), problems, failed)
+	if *enqueue && len(queue) > 0 {
+		failed += runQueue(queue, token, "")
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// auditFolders finds the album folders below root. Folders whose files belong to several albums,
+// such as playlist folders, are skipped.
+func auditFolders(root string, codec string, token string) ([]*auditAlbum, error) {
+	dirs := map[string][]auditFile{}
+	var order []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".m4a") {
+			return nil
+		}
+		file, err := readRetagFile(path)
+		if err != nil {
+			fmt.Printf("\u26A0 %s: %v\n", path, err)
+			return nil
+		}
+		f := auditFile{path: path, id: file.catalogID(), isrc: file.tags.Custom["ISRC"], album: file.tags.Album, albumID: file.tags.ItunesAlbumID}
+		dir := filepath.Dir(path)
+		if _, ok := dirs[dir]; !ok {
+			order = append(order, dir)
+		}
+		dirs[dir] = append(dirs[dir], f)
+		return nil
+	})
+
+	cache := map[string]*task.Album{}
+	byFolder := map[string]*auditAlbum{}
+	var albums []*auditAlbum
+	for _, dir := range order {
+		files := dirs[dir]
+		albumID, err := auditAlbumID(files, token)
+		if err != nil {
+			fmt.Printf("\u26A0 %s: %v\n", dir, err)
+			continue
+		}
+		if albumID == "" {
+			continue
+		}
+		album, ok := cache[albumID]
+		if !ok {
+			album = task.NewAlbum(Config.Storefront, albumID)
+			if err := album.GetResp(token, Config.Language); err != nil {
+				fmt.Printf("\u26A0 %s: %v\n", dir, err)
 				continue
 			}
-			if strings.Contains(urlRaw, "/song/") {
-				fmt.Printf("Song->")
-				storefront, songId := checkUrlSong(urlRaw)
-				if storefront == "" || songId == "" {
-					fmt.Println("Invalid song URL format.")
+			cache[albumID] = album
+		}
+		folder := albumFolderOf(dir, album, files)
+		key := folder + "\x00" + albumID
+		a, ok := byFolder[key]
+		if !ok {
+			a = &auditAlbum{folder: folder, codec: codec, album: album}
+			byFolder[key] = a
+			albums = append(albums, a)
+		}
+		a.files = append(a.files, files...)
+	}
+	return albums, err
+}
+
+// auditAlbumID returns the album the files of one folder belong to, or "" when they belong to
+// several albums or were tagged from a playlist.
+func auditAlbumID(files []auditFile, token string) (string, error) {
+	var id int32
+	for _, f := range files {
+		if f.albumID == 0 || (id != 0 && f.albumID != id) {
+			id = 0
+			break
+		}
+		id = f.albumID
+	}
+	if id != 0 {
+		return strconv.FormatUint(uint64(uint32(id)), 10), nil
+	}
+	for _, f := range files {
+		if f.albumID != 0 {
+			return "", nil
+		}
+	}
+	// files written before plID was tagged: look the first one up and accept its album
+	// when the album tag agrees, which a playlist-tagged file would not
+	f := files[0]
+	var song *ampapi.SongResp
+	var err error
+	if f.id != "" {
+		song, err = ampapi.GetSongResp(Config.Storefront, f.id, Config.Language, token)
+	} else if f.isrc != "" {
+		song, err = ampapi.GetSongsByIsrc(Config.Storefront, f.isrc, Config.Language, token)
+	} else {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(song.Data) == 0 {
+		return "", errors.New("song not found")
+	}
+	for _, album := range song.Data[0].Relationships.Albums.Data {
+		if album.Attributes.Name == f.album {
+			return album.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// albumFolderOf strips the disc and work subfolders trackFolder would have added from dir.
+func albumFolderOf(dir string, album *task.Album, files []auditFile) string {
+	for _, f := range files {
+		if t := albumTrack(album, f); t != nil {
+			if sub := trackFolder("", &t.Resp, t.DiscTotal); sub != "" && strings.HasSuffix(dir, string(filepath.Separator)+sub) {
+				return strings.TrimSuffix(dir, string(filepath.Separator)+sub)
+			}
+			return dir
+		}
+	}
+	return dir
+}
+
+// audit returns the IDs of the tracks missing from the folder and a line for every problem found.
+func (a *auditAlbum) audit() ([]string, []string) {
+	var missing, findings []string
+	found := map[string]string{}
+	for _, f := range a.files {
+		t := albumTrack(a.album, f)
+		if t == nil {
+			findings = append(findings, "extra: "+a.rel(f.path))
+			continue
+		}
+		if _, dup := found[t.ID]; dup {
+			findings = append(findings, "duplicate: "+a.rel(f.path))
+			continue
+		}
+		found[t.ID] = f.path
+		if !usesQuality(songFileTemplate) {
+			expected := filepath.Join(trackFolder(a.folder, &t.Resp, t.DiscTotal), a.fileName(t))
+			if expected != f.path {
+				findings = append(findings, fmt.Sprintf("misnamed: %s, expected %s", a.rel(f.path), a.rel(expected)))
+			}
+		}
+		if Config.SaveLrcFile && t.Resp.Attributes.HasLyrics {
+			lrcPath := strings.TrimSuffix(f.path, filepath.Ext(f.path)) + "." + Config.LrcFormat
+			if ok, _ := fileExists(lrcPath); !ok {
+				findings = append(findings, "missing lyrics: "+a.rel(lrcPath))
+			}
+		}
+	}
+	for _, t := range a.album.Tracks {
+		if t.Type != "songs" {
+			continue
+		}
+		if _, ok := found[t.ID]; !ok {
+			missing = append(missing, t.ID)
+			findings = append(findings, fmt.Sprintf("missing: %d-%02d %s", t.Resp.Attributes.DiscNumber, t.Resp.Attributes.TrackNumber, t.Name))
+		}
+	}
+	if !hasCover(a.folder) {
+		findings = append(findings, "missing cover")
+	}
+	return missing, findings
+}
+
+// albumTrack returns the track of album f holds, matched by catalog ID or else by ISRC.
+func albumTrack(album *task.Album, f auditFile) *task.Track {
+	for i := range album.Tracks {
+		t := &album.Tracks[i]
+		if t.Type == "songs" && ((f.id != "" && t.ID == f.id) || (f.id == "" && f.isrc != "" && t.Resp.Attributes.Isrc == f.isrc)) {
+			return t
+		}
+	}
+	return nil
+}
+
+// fileName is the name downloadTrack gives the file of t.
+func (a *auditAlbum) fileName(t *task.Track) string {
+	number := songNumber(&t.Resp, t.TaskNum, t.DiscTotal)
+	songName := songFileName(&t.Resp, &t.AlbumData, number, "", a.codec)
+	return fmt.Sprintf("%s.m4a", forbiddenNames.ReplaceAllString(songName, "_"))
+}
+
+func (a *auditAlbum) rel(path string) string {
+	if rel, err := filepath.Rel(a.folder, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// hasCover reports whether the album folder has the cover.<format> file ripAlbum writes.
+func hasCover(folder string) bool {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		ext := strings.TrimPrefix(filepath.Ext(e.Name()), ".")
+		if strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())) == "cover" && (Config.CoverFormat == "original" || ext == Config.CoverFormat) {
+			return true
+		}
+	}
+	return false
+}
+
+// release is an album or music video of a watched artist. Kind is a discography.Type or "music-video".
+type release struct {
+	id, kind, name, date, url string
+}
+
+// artistReleases pages through the albums and, if asked for, the music videos of an artist.
+func artistReleases(client *ampapi.Client, artistID string, musicVideos bool) ([]release, error) {
+	albums, err := client.GetArtistAlbums(artistID)
+	if err != nil {
+		return nil, err
+	}
+	var releases []release
+	for i := range albums {
+		a := &albums[i]
+		releases = append(releases, release{a.ID, discography.Type(a), a.Attributes.Name, a.Attributes.ReleaseDate, a.Attributes.URL})
+	}
+	if musicVideos {
+		videos, err := client.GetArtistMusicVideos(artistID)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			releases = append(releases, release{v.ID, "music-video", v.Attributes.Name, v.Attributes.ReleaseDate, v.Attributes.URL})
+		}
+	}
+	sort.SliceStable(releases, func(i, j int) bool { return releases[i].date < releases[j].date })
+	return releases, nil
+}
+
+// downloaded reports whether the download history already has tracks of r.
+func (r release) downloaded() bool {
+	if r.kind == "music-video" {
+		_, ok := dlHistory.Find(history.Query{ID: r.id})
+		return ok
+	}
+	_, ok := dlHistory.Find(history.Query{PreType: "albums", PreID: r.id})
+	return ok
+}
+
+func runWatch(args []string, token string) int {
+	flags := pflag.NewFlagSet("watch", pflag.ExitOnError)
+	types := flags.StringSlice("types", []string{"album", "ep", "single", "compilation", "live", "music-video"}, "Release types to act on: album, ep, single, compilation, live, music-video")
+	since := flags.String("since", "", "Only act on releases dated on or after this day (YYYY-MM-DD)")
+	until := flags.String("until", "", "Only act on releases dated on or before this day (YYYY-MM-DD)")
+	reportOnly := flags.Bool("report-only", false, "List the new releases and mark them as seen without downloading")
+	atmos := flags.Bool("atmos", false, "Download the new releases in Dolby Atmos")
+	aac := flags.Bool("aac", false, "Download the new releases in AAC")
+	reportPath := flags.String("report", "", "Write a JSON report of the downloads to this file")
+	flags.BoolVar(&non_interactive, "non-interactive", false, "Never prompt while downloading")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s watch [add <artist url|id> ... | remove <artist id> ... | list | check] [options]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintln(os.Stderr, "Keeps a list of artists and downloads (or reports) what they released since the last check.")
+		fmt.Println("\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	for _, day := range []string{*since, *until} {
+		if _, err := time.Parse("2006-01-02", day); day != "" && err != nil {
+			fmt.Println("Invalid date:", day)
+			return 1
+		}
+	}
+	path := Config.WatchFile
+	if path == "" {
+		path = "watch.json"
+	}
+	list, err := watch.Load(path)
+	if err != nil {
+		fmt.Println("Failed to load watch list:", err)
+		return 1
+	}
+	cmd, rest := "check", flags.Args()
+	if len(rest) > 0 {
+		cmd, rest = rest[0], rest[1:]
+	}
+
+	switch cmd {
+	case "list":
+		for _, a := range list.Artists {
+			checked := "never"
+			if !a.Checked.IsZero() {
+				checked = a.Checked.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%s  %s (%s)  checked: %s  releases seen: %d\n", a.ID, a.Name, a.Storefront, checked, len(a.Seen))
+		}
+		return 0
+	case "remove":
+		for _, id := range rest {
+			if !list.Remove(id) {
+				fmt.Println("Not watched:", id)
+			}
+		}
+	case "add":
+		for _, arg := range rest {
+			storefront, id := checkUrlArtist(arg)
+			if id == "" {
+				if _, err := strconv.Atoi(arg); err != nil {
+					fmt.Println("Invalid artist URL or ID:", arg)
 					continue
 				}
-				err := ripSong(songId, token, storefront, Config.MediaUserToken)
-				if err != nil {
-					fmt.Println("Failed to rip song:", err)
-				}
+				storefront, id = Config.Storefront, arg
+			}
+			if list.Find(id) != nil {
+				fmt.Println("Already watched:", id)
+				continue
+			}
+			client := ampapi.NewClient(storefront, Config.Language, token)
+			artist, err := client.GetArtistResp(id)
+			if err != nil {
+				fmt.Println("Failed to get artist:", err)
 				continue
 			}
-			parse, err := url.Parse(urlRaw)
+			// what is out now is the baseline, only later releases count as new
+			releases, err := artistReleases(client, id, true)
 			if err != nil {
-				log.Fatalf("Invalid URL: %v", err)
+				fmt.Println("Failed to get releases:", err)
+				continue
+			}
+			a := &watch.Artist{ID: id, Storefront: storefront, Name: artist.Data[0].Attributes.Name, Checked: time.Now()}
+			for _, r := range releases {
+				a.MarkSeen(r.id)
 			}
-			var urlArg_i = parse.Query().Get("i")
+			list.Add(a)
+			fmt.Printf("Watching %s, %d current releases marked as seen\n", a.Name, len(releases))
+		}
+	case "check":
+		return checkWatched(list, token, *types, *since, *until, *reportOnly, watchOptions(*atmos, *aac), *reportPath)
+	default:
+		flags.Usage()
+		return 1
+	}
+	if err := list.Save(); err != nil {
+		fmt.Println("Failed to save watch list:", err)
+		return 1
+	}
+	return 0
+}
 
-			if strings.Contains(urlRaw, "/album/") {
-				fmt.Println("Album")
-				storefront, albumId = checkUrl(urlRaw)
-				err := ripAlbum(albumId, token, storefront, Config.MediaUserToken, urlArg_i)
-				if err != nil {
-					fmt.Println("Failed to rip album:", err)
-				}
-			} else if strings.Contains(urlRaw, "/playlist/") {
-				fmt.Println("Playlist")
-				storefront, albumId = checkUrlPlaylist(urlRaw)
-				err := ripPlaylist(albumId, token, storefront, Config.MediaUserToken)
-				if err != nil {
-					fmt.Println("Failed to rip playlist:", err)
-				}
-			} else if strings.Contains(urlRaw, "/station/") {
-				fmt.Printf("Station")
-				storefront, albumId = checkUrlStation(urlRaw)
-				if len(Config.MediaUserToken) <= 50 {
-					fmt.Println(": meida-user-token is not set, skip station dl")
-					continue
-				}
-				err := ripStation(albumId, token, storefront, Config.MediaUserToken)
-				if err != nil {
-					fmt.Println("Failed to rip station:", err)
-				}
-			} else {
-				fmt.Println("Invalid type")
+func watchOptions(atmos, aac bool) []string {
+	if atmos {
+		return []string{"--atmos"}
+	}
+	if aac {
+		return []string{"--aac"}
+	}
+	return nil
+}
+
+// checkWatched looks for releases of the watched artists that were neither seen nor downloaded
+// before and downloads or lists them. Releases are marked as seen unless their download failed.
+func checkWatched(list *watch.List, token string, types []string, since, until string, reportOnly bool, options []string, reportPath string) int {
+	type pending struct {
+		artist  *watch.Artist
+		release release
+	}
+	var found []pending
+	failed := 0
+	for _, a := range list.Artists {
+		fmt.Printf("Checking %s...\n", a.Name)
+		releases, err := artistReleases(ampapi.NewClient(a.Storefront, Config.Language, token), a.ID, contains(types, "music-video"))
+		if err != nil {
+			fmt.Println("Failed to get releases:", err)
+			failed++
+			continue
+		}
+		for _, r := range releases {
+			if a.HasSeen(r.id) || !contains(types, r.kind) || (since != "" && r.date < since) || (until != "" && r.date > until) {
+				continue
+			}
+			if r.downloaded() {
+				a.MarkSeen(r.id)
+				continue
+			}
+			fmt.Printf("  New %s: %s (%s)\n", r.kind, r.name, r.date)
+			found = append(found, pending{a, r})
+		}
+		a.Checked = time.Now()
+	}
+
+	if !reportOnly && len(found) > 0 {
+		var queue []queueItem
+		for _, p := range found {
+			queue = append(queue, queueItem{URL: p.release.url, Options: options, ArtistName: p.artist.Name, ArtistID: p.artist.ID})
+		}
+		failed += runQueue(queue, token, reportPath)
+	}
+	// a release is seen once the last attempt at its URL got at least one track and no failures,
+	// so releases that failed or recorded nothing are offered again
+	doneURLs := map[string]bool{}
+	if !reportOnly && runReport != nil {
+		for _, item := range runReport.Items {
+			done := item.Error == ""
+			succeeded := false
+			for _, t := range item.Tracks {
+				done = done && !t.Failed()
+				succeeded = succeeded || t.Outcome == report.Success
+			}
+			doneURLs[item.URL] = done && succeeded
+		}
+	}
+	for _, p := range found {
+		if reportOnly || doneURLs[p.release.url] {
+			p.artist.MarkSeen(p.release.id)
+		}
+	}
+	if err := list.Save(); err != nil {
+		fmt.Println("Failed to save watch list:", err)
+		failed++
+	}
+	fmt.Printf("=======  Artists: %d  |  New releases: %d  |  [\u2716 ] Errors: %d  =======\n", len(list.Artists), len(found), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	err := loadConfig()
+	if err != nil {
+		fmt.Printf("load Config failed: %v\n", err)
+		os.Exit(1)
+	}
+	token, err := ampapi.GetToken()
+	if err != nil {
+		if Config.AuthorizationToken != "" && Config.AuthorizationToken != "your-authorization-token" {
+			token = strings.Replace(Config.AuthorizationToken, "Bearer ", "", -1)
+		} else {
+			fmt.Println("Failed to get token.")
+			os.Exit(1)
+		}
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "retag":
+			os.Exit(runRetag(os.Args[2:], token))
+		case "audit":
+			os.Exit(runAudit(os.Args[2:], token))
+		case "watch":
+			os.Exit(runWatch(os.Args[2:], token))
+		}
+	}
+	var search_type string
+	var input_file string
+	var report_path string
+	var retry_failed string
+	pflag.StringVar(&search_type, "search", "", "Search for 'album', 'song', or 'artist'. Provide query after flags.")
+	pflag.BoolVar(&dl_atmos, "atmos", false, "Enable atmos download mode")
+	pflag.BoolVar(&dl_aac, "aac", false, "Enable adm-aac download mode")
+	pflag.BoolVar(&dl_select, "select", false, "Enable selective download")
+	pflag.BoolVar(&dl_song, "song", false, "Enable single song download mode")
+	pflag.BoolVar(&artist_select, "all-album", false, "Download all artist albums")
+	pflag.StringSliceVar(&album_types, "album-type", nil, "Only list artist albums of these types: album, single, ep, compilation, live")
+	pflag.StringVar(&prefer_rating, "prefer-rating", "", "Skip the clean (explicit) version of artist albums that also have an explicit (clean) one: explicit, clean")
+	pflag.StringVar(&release_years, "years", "", "Only list artist releases from these years, e.g. 2012, 2010-2015, 2010- or -2015")
+	pflag.StringVar(&name_filter, "name-filter", "", "Only list artist releases whose name matches this regular expression")
+	pflag.BoolVar(&collapse_editions, "collapse-editions", false, "List one edition of artist albums sharing a base title, the one with the most tracks")
+	pflag.BoolVar(&debug_mode, "debug", false, "Enable debug mode to show audio quality information")
+	pflag.StringVar(&input_file, "input-file", "", "Read URLs from a file, one per line (# comments and per-line options like --atmos allowed)")
+	pflag.BoolVar(&non_interactive, "non-interactive", false, "Never prompt; select everything and exit non-zero if any error occurred")
+	pflag.StringVar(&report_path, "report", "", "Write a JSON report of every queued URL and track outcome to this path")
+	pflag.StringVar(&retry_failed, "retry-failed", "", "Re-queue only the failed and unavailable tracks of a previous --report file")
+	alac_max = pflag.Int("alac-max", Config.AlacMax, "Specify the max quality for download alac")
+	atmos_max = pflag.Int("atmos-max", Config.AtmosMax, "Specify the max quality for download atmos")
+	aac_type = pflag.String("aac-type", Config.AacType, "Select AAC type, aac aac-binaural aac-downmix")
+	mv_audio_type = pflag.String("mv-audio-type", Config.MVAudioType, "Select MV audio type, atmos ac3 aac")
+	mv_max = pflag.Int("mv-max", Config.MVMax, "Specify the max quality for download MV")
+
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [url1 url2 ...]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintf(os.Stderr, "Search Usage: %s --search [album|song|artist] [query]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintf(os.Stderr, "Retag Usage: %s retag [--dry-run] [folder ...]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintf(os.Stderr, "Audit Usage: %s audit [--enqueue]\n", "[main | main.exe | go run main.go]")
+		fmt.Fprintf(os.Stderr, "Watch Usage: %s watch [add <artist url|id> ... | remove <artist id> ... | list | check]\n", "[main | main.exe | go run main.go]")
+		fmt.Println("\nOptions:")
+		pflag.PrintDefaults()
+	}
+
+	pflag.Parse()
+	Config.AlacMax = *alac_max
+	Config.AtmosMax = *atmos_max
+	Config.AacType = *aac_type
+	Config.MVAudioType = *mv_audio_type
+	Config.MVMax = *mv_max
+
+	args := pflag.Args()
+
+	var queue []queueItem
+	if search_type != "" {
+		if non_interactive {
+			fmt.Println("Error: --search cannot be used with --non-interactive.")
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			fmt.Println("Error: --search flag requires a query.")
+			pflag.Usage()
+			return
+		}
+		selectedUrl, err := handleSearch(search_type, args, token)
+		if err != nil {
+			fmt.Printf("\nSearch process failed: %v\n", err)
+			return
+		}
+		if selectedUrl == "" {
+			fmt.Println("\nExiting.")
+			return
+		}
+		queue = []queueItem{{URL: selectedUrl}}
+	} else {
+		for _, arg := range args {
+			queue = append(queue, queueItem{URL: arg})
+		}
+		if input_file != "" {
+			items, err := readInputFile(input_file)
+			if err != nil {
+				fmt.Println("Failed to read input file:", err)
+				os.Exit(1)
+			}
+			queue = append(queue, items...)
+		}
+		if retry_failed != "" {
+			previous, err := report.Load(retry_failed)
+			if err != nil {
+				fmt.Println("Failed to read report:", err)
+				os.Exit(1)
+			}
+			failed := failedQueue(previous)
+			fmt.Printf("Retrying %d failed item(s) from %s\n", len(failed), retry_failed)
+			queue = append(queue, failed...)
+			if len(queue) == 0 {
+				return
+			}
+		}
+		if len(queue) == 0 {
+			fmt.Println("No URLs provided. Please provide at least one URL.")
+			pflag.Usage()
+			return
+		}
+	}
+
+	queue, err = expandArtists(queue, token)
+	if err != nil {
+		fmt.Println(err)
+		if non_interactive {
+			os.Exit(1)
+		}
+		return
+	}
+	if runQueue(queue, token, report_path) > 0 {
+		os.Exit(1)
+	}
+}
+
+// runQueue downloads every item of queue, offering to retry the failures until there are none,
+// and writes the run report to reportPath if set. It returns the number of errors.
+func runQueue(queue []queueItem, token string, reportPath string) int {
+	runReport = report.New()
+	for {
+		albumTotal := len(queue)
+		for albumNum, item := range queue {
+			fmt.Printf("Queue %d of %d: ", albumNum+1, albumTotal)
+			reportItem = runReport.Add(item.URL, item.Options)
+			reportItem.ArtistName, reportItem.ArtistID = item.ArtistName, item.ArtistID
+			opts, err := item.options()
+			if err != nil {
+				fmt.Println("Invalid options:", err)
+				reportItem.Fail(err)
+				counter.Error++
+				continue
 			}
+			saved := currentOptions()
+			opts.apply()
+			ripUrl(item.URL, token)
+			saved.apply()
 		}
 		fmt.Printf("=======  [\u2714 ] Completed: %d/%d  |  [\u26A0 ] Warnings: %d  |  [\u2716 ] Errors: %d  =======\n", counter.Success, counter.Total, counter.Unavailable+counter.NotSong, counter.Error)
-		if counter.Error == 0 {
+		if counter.Error == 0 || non_interactive {
 			break
 		}
 		fmt.Println("Error detected, press Enter to try again...")
 		fmt.Scanln()
 		fmt.Println("Start trying again...")
 		counter = structs.Counter{}
+		queue = failedQueue(runReport)
+	}
+	if reportPath != "" {
+		if err := runReport.Write(reportPath); err != nil {
+			fmt.Println("Failed to write report:", err)
+		} else {
+			fmt.Println("Report written to", reportPath)
+		}
+	}
+	return counter.Error
+}
+
+// ripUrl downloads everything behind a single album, playlist, station, song or music video URL.
+func ripUrl(urlRaw string, token string) {
+	var storefront, albumId string
+
+	if strings.Contains(urlRaw, "/music-video/") {
+		fmt.Println("Music Video")
+		if debug_mode {
+			return
+		}
+		storefront, albumId = checkUrlMv(urlRaw)
+		mvTrack := report.Track{ID: albumId, Type: "music-videos"}
+		if len(Config.MediaUserToken) <= 50 {
+			fmt.Println(": meida-user-token is not set, skip MV dl")
+			recordTrack(mvTrack, report.Unavailable, errors.New("media-user-token is not set"))
+			return
+		}
+		if _, err := exec.LookPath("mp4decrypt"); err != nil {
+			fmt.Println(": mp4decrypt is not found, skip MV dl")
+			recordTrack(mvTrack, report.Unavailable, errors.New("mp4decrypt is not found"))
+			return
+		}
+		mvSaveDir := renderArtistFolder("", "")
+		if mvSaveDir != "" {
+			mvSaveDir = filepath.Join(Config.AlacSaveFolder, forbiddenNames.ReplaceAllString(mvSaveDir, "_"))
+		} else {
+			mvSaveDir = Config.AlacSaveFolder
+		}
+		err := mvDownloader(albumId, mvSaveDir, token, storefront, Config.MediaUserToken, nil)
+		if err != nil {
+			fmt.Println("\u26A0 Failed to dl MV:", err)
+			recordTrack(mvTrack, report.Error, err)
+			return
+		}
+		recordTrack(mvTrack, report.Success, nil)
+		return
+	}
+	if strings.Contains(urlRaw, "/song/") {
+		fmt.Printf("Song->")
+		storefront, songId := checkUrlSong(urlRaw)
+		if storefront == "" || songId == "" {
+			fmt.Println("Invalid song URL format.")
+			reportItem.Fail(errors.New("invalid song URL format"))
+			counter.Error++
+			return
+		}
+		err := ripSong(songId, token, storefront, Config.MediaUserToken)
+		if err != nil {
+			fmt.Println("Failed to rip song:", err)
+			reportItem.Fail(err)
+			counter.Error++
+		}
+		return
+	}
+	parse, err := url.Parse(urlRaw)
+	if err != nil {
+		log.Fatalf("Invalid URL: %v", err)
+	}
+	var urlArg_i = parse.Query().Get("i")
+
+	if strings.Contains(urlRaw, "/album/") {
+		fmt.Println("Album")
+		storefront, albumId = checkUrl(urlRaw)
+		albumId, urlArg_i, albumResp := preferredAlbum(storefront, albumId, urlArg_i, token)
+		err := ripAlbum(albumId, token, storefront, Config.MediaUserToken, urlArg_i, albumResp)
+		if err != nil {
+			fmt.Println("Failed to rip album:", err)
+			reportItem.Fail(err)
+			counter.Error++
+		}
+	} else if strings.Contains(urlRaw, "/playlist/") {
+		fmt.Println("Playlist")
+		storefront, albumId = checkUrlPlaylist(urlRaw)
+		err := ripPlaylist(albumId, token, storefront, Config.MediaUserToken)
+		if err != nil {
+			fmt.Println("Failed to rip playlist:", err)
+			reportItem.Fail(err)
+			counter.Error++
+		}
+	} else if strings.Contains(urlRaw, "/station/") {
+		fmt.Printf("Station")
+		storefront, albumId = checkUrlStation(urlRaw)
+		if len(Config.MediaUserToken) <= 50 {
+			fmt.Println(": meida-user-token is not set, skip station dl")
+			recordTrack(report.Track{ID: albumId, Type: "stations"}, report.Unavailable, errors.New("media-user-token is not set"))
+			return
+		}
+		err := ripStation(albumId, token, storefront, Config.MediaUserToken)
+		if err != nil {
+			fmt.Println("Failed to rip station:", err)
+			reportItem.Fail(err)
+			counter.Error++
+		}
+	} else {
+		fmt.Println("Invalid type")
+		reportItem.Fail(errors.New("invalid type"))
+		counter.Error++
 	}
 }
 
@@ -1974,7 +4007,7 @@ func mvDownloader(adamID string, saveDir string, token string, storefront string
 	MVInfo, err := ampapi.GetMusicVideoResp(storefront, adamID, Config.Language, token)
 	if err != nil {
 		fmt.Println("\u26A0 Failed to get MV manifest:", err)
-		return nil
+		return err
 	}
 
 	if strings.HasSuffix(saveDir, ".") {
@@ -2014,78 +4047,73 @@ func mvDownloader(adamID string, saveDir string, token string, storefront string
 	_ = runv3.ExtMvData(audiokeyAndUrls, audPath)
 	defer os.Remove(audPath)
 
-	tags := []string{
-		"tool=",
-		fmt.Sprintf("artist=%s", MVInfo.Data[0].Attributes.ArtistName),
-		fmt.Sprintf("title=%s", MVInfo.Data[0].Attributes.Name),
-		fmt.Sprintf("genre=%s", MVInfo.Data[0].Attributes.GenreNames[0]),
-		fmt.Sprintf("created=%s", MVInfo.Data[0].Attributes.ReleaseDate),
-		fmt.Sprintf("ISRC=%s", MVInfo.Data[0].Attributes.Isrc),
+	mvAttrs := MVInfo.Data[0].Attributes
+	t := &mp4tag.MP4Tags{
+		Artist: mvAttrs.ArtistName,
+		Title:  mvAttrs.Name,
+		Date:   mvAttrs.ReleaseDate,
+		Custom: map[string]string{"ISRC": mvAttrs.Isrc},
+	}
+	if len(mvAttrs.GenreNames) > 0 {
+		t.CustomGenre = mvAttrs.GenreNames[0]
 	}
 
-	if MVInfo.Data[0].Attributes.ContentRating == "explicit" {
-		tags = append(tags, "rating=1")
-	} else if MVInfo.Data[0].Attributes.ContentRating == "clean" {
-		tags = append(tags, "rating=2")
+	if mvAttrs.ContentRating == "explicit" {
+		t.ItunesAdvisory = mp4tag.ItunesAdvisoryExplicit
+	} else if mvAttrs.ContentRating == "clean" {
+		t.ItunesAdvisory = mp4tag.ItunesAdvisoryClean
 	} else {
-		tags = append(tags, "rating=0")
+		t.ItunesAdvisory = mp4tag.ItunesAdvisoryNone
 	}
 
 	if track != nil {
+		t.Custom["PERFORMER"] = track.Resp.Attributes.ArtistName
 		if track.PreType == "playlists" && !Config.UseSongInfoForPlaylist {
-			tags = append(tags, "disk=1/1")
-			tags = append(tags, fmt.Sprintf("album=%s", track.PlaylistData.Attributes.Name))
-			tags = append(tags, fmt.Sprintf("track=%d", track.TaskNum))
-			tags = append(tags, fmt.Sprintf("tracknum=%d/%d", track.TaskNum, track.TaskTotal))
-			tags = append(tags, fmt.Sprintf("album_artist=%s", track.PlaylistData.Attributes.ArtistName))
-			tags = append(tags, fmt.Sprintf("performer=%s", track.Resp.Attributes.ArtistName))
-		} else if track.PreType == "playlists" && Config.UseSongInfoForPlaylist {
-			tags = append(tags, fmt.Sprintf("album=%s", track.AlbumData.Attributes.Name))
-			tags = append(tags, fmt.Sprintf("disk=%d/%d", track.Resp.Attributes.DiscNumber, track.DiscTotal))
-			tags = append(tags, fmt.Sprintf("track=%d", track.Resp.Attributes.TrackNumber))
-			tags = append(tags, fmt.Sprintf("tracknum=%d/%d", track.Resp.Attributes.TrackNumber, track.AlbumData.Attributes.TrackCount))
-			tags = append(tags, fmt.Sprintf("album_artist=%s", track.AlbumData.Attributes.ArtistName))
-			tags = append(tags, fmt.Sprintf("performer=%s", track.Resp.Attributes.ArtistName))
-			tags = append(tags, fmt.Sprintf("copyright=%s", track.AlbumData.Attributes.Copyright))
-			tags = append(tags, fmt.Sprintf("UPC=%s", track.AlbumData.Attributes.Upc))
+			t.DiscNumber = 1
+			t.DiscTotal = 1
+			t.Album = track.PlaylistData.Attributes.Name
+			t.TrackNumber = int16(track.TaskNum)
+			t.TrackTotal = int16(track.TaskTotal)
+			t.AlbumArtist = track.PlaylistData.Attributes.ArtistName
 		} else {
-			tags = append(tags, fmt.Sprintf("album=%s", track.AlbumData.Attributes.Name))
-			tags = append(tags, fmt.Sprintf("disk=%d/%d", track.Resp.Attributes.DiscNumber, track.DiscTotal))
-			tags = append(tags, fmt.Sprintf("track=%d", track.Resp.Attributes.TrackNumber))
-			tags = append(tags, fmt.Sprintf("tracknum=%d/%d", track.Resp.Attributes.TrackNumber, track.AlbumData.Attributes.TrackCount))
-			tags = append(tags, fmt.Sprintf("album_artist=%s", track.AlbumData.Attributes.ArtistName))
-			tags = append(tags, fmt.Sprintf("performer=%s", track.Resp.Attributes.ArtistName))
-			tags = append(tags, fmt.Sprintf("copyright=%s", track.AlbumData.Attributes.Copyright))
-			tags = append(tags, fmt.Sprintf("UPC=%s", track.AlbumData.Attributes.Upc))
+			t.Album = track.AlbumData.Attributes.Name
+			t.DiscNumber = int16(track.Resp.Attributes.DiscNumber)
+			t.DiscTotal = int16(track.DiscTotal)
+			t.TrackNumber = int16(track.Resp.Attributes.TrackNumber)
+			t.TrackTotal = int16(track.AlbumData.Attributes.TrackCount)
+			t.AlbumArtist = track.AlbumData.Attributes.ArtistName
+			t.Copyright = track.AlbumData.Attributes.Copyright
+			t.Custom["UPC"] = track.AlbumData.Attributes.Upc
 		}
 	} else {
-		tags = append(tags, fmt.Sprintf("album=%s", MVInfo.Data[0].Attributes.AlbumName))
-		tags = append(tags, fmt.Sprintf("disk=%d", MVInfo.Data[0].Attributes.DiscNumber))
-		tags = append(tags, fmt.Sprintf("track=%d", MVInfo.Data[0].Attributes.TrackNumber))
-		tags = append(tags, fmt.Sprintf("tracknum=%d", MVInfo.Data[0].Attributes.TrackNumber))
-		tags = append(tags, fmt.Sprintf("performer=%s", MVInfo.Data[0].Attributes.ArtistName))
+		t.Album = mvAttrs.AlbumName
+		t.DiscNumber = int16(mvAttrs.DiscNumber)
+		t.TrackNumber = int16(mvAttrs.TrackNumber)
+		t.Custom["PERFORMER"] = mvAttrs.ArtistName
 	}
 
 	var covPath string
 	if true {
-		thumbURL := MVInfo.Data[0].Attributes.Artwork.URL
+		thumbURL := mvAttrs.Artwork.URL
 		baseThumbName := forbiddenNames.ReplaceAllString(mvSaveName, "_") + "_thumbnail"
 		covPath, err = writeCover(saveDir, baseThumbName, thumbURL)
 		if err != nil {
 			fmt.Println("Failed to save MV thumbnail:", err)
-		} else {
-			tags = append(tags, fmt.Sprintf("cover=%s", covPath))
+			covPath = ""
 		}
 	}
 	defer os.Remove(covPath)
 
-	tagsString := strings.Join(tags, ":")
-	muxCmd := exec.Command("MP4Box", "-itags", tagsString, "-quiet", "-add", vidPath, "-add", audPath, "-keep-utc", "-new", mvOutPath)
+	muxCmd := exec.Command("MP4Box", "-quiet", "-add", vidPath, "-add", audPath, "-keep-utc", "-new", mvOutPath)
 	fmt.Printf("MV Remuxing...")
 	if err := muxCmd.Run(); err != nil {
 		fmt.Printf("MV mux failed: %v\n", err)
 		return err
 	}
+	if err := tagFile(mvOutPath, t, covPath); err != nil {
+		fmt.Printf("\rMV tagging failed: %v\n", err)
+		return err
+	}
 	fmt.Printf("\rMV Remuxed.   \n")
 	return nil
 }
@@ -2499,11 +4527,11 @@ func ripSong(songId string, token string, storefront string, mediaUserToken stri
 	}
 
 	songData := manifest.Data[0]
-	albumId := songData.Relationships.Albums.Data[0].ID
+	albumId, songId, albumResp := preferredAlbum(storefront, songData.Relationships.Albums.Data[0].ID, songId, token)
 
 	// Use album approach but only download the specific song
 	dl_song = true
-	err = ripAlbum(albumId, token, storefront, mediaUserToken, songId)
+	err = ripAlbum(albumId, token, storefront, mediaUserToken, songId, albumResp)
 	if err != nil {
 		fmt.Println("Failed to rip song:", err)
 		return err
@@ -1,30 +1,21 @@
 package ampapi
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
 )
 
 func GetAlbumResp(storefront string, id string, language string, token string) (*AlbumResp, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return nil, err
-		}
-	}
+	return NewClient(storefront, language, token).GetAlbumResp(id)
+}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com/v1/catalog/%s/albums/%s", storefront, id), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
+func GetAlbumRespByHref(href string, language string, token string) (*AlbumResp, error) {
+	return NewClient("", language, token).GetAlbumRespByHref(href)
+}
+
+func albumQuery(language string) url.Values {
 	query := url.Values{}
 	query.Set("omit[resource]", "autos")
 	query.Set("include", "tracks,artists,record-labels")
@@ -34,131 +25,47 @@ func GetAlbumResp(storefront string, id string, language string, token string) (
 	//query.Set("fields[record-labels]", "name")
 	query.Set("extend", "editorialVideo,extendedAssetUrls")
 	query.Set("l", language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
-	}
-	obj := new(AlbumResp)
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return nil, err
-	}
-	if len(obj.Data[0].Relationships.Tracks.Next) > 0 {
-		next := obj.Data[0].Relationships.Tracks.Next
-		for {
-			req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com%s", next), nil)
-			if err != nil {
-				return nil, err
-			}
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-			req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-			req.Header.Set("Origin", "https://music.apple.com")
-			query := req.URL.Query()
-			query.Set("omit[resource]", "autos")
-			query.Set("include", "artists")
-			query.Set("extend", "editorialVideo,extendedAssetUrls")
-			req.URL.RawQuery = query.Encode()
-			do, err := http.DefaultClient.Do(req)
-			if err != nil {
-				return nil, err
-			}
-			defer do.Body.Close()
-			if do.StatusCode != http.StatusOK {
-				return nil, errors.New(do.Status)
-			}
-			obj2 := new(TrackResp)
-			err = json.NewDecoder(do.Body).Decode(&obj2)
-			if err != nil {
-				return nil, err
-			}
-			obj.Data[0].Relationships.Tracks.Data = append(obj.Data[0].Relationships.Tracks.Data, obj2.Data...)
-			next = obj2.Next
-			if len(next) == 0 {
-				break
-			}
-		}
-	}
-	return obj, nil
+	return query
 }
 
-func GetAlbumRespByHref(href string, language string, token string) (*AlbumResp, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return nil, err
-		}
-	}
+func (c *Client) GetAlbumResp(id string) (*AlbumResp, error) {
+	return c.getAlbum(fmt.Sprintf("/v1/catalog/%s/albums/%s", c.Storefront, id))
+}
+
+// GetAlbumRespByHref fetches the album a song belongs to from the song's href.
+func (c *Client) GetAlbumRespByHref(href string) (*AlbumResp, error) {
 	href = strings.Split(href, "?")[0]
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com%s/albums", href), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
+	return c.getAlbum(href + "/albums")
+}
+
+// GetAlbumOtherVersions lists the other editions of an album, such as its clean or explicit version.
+func (c *Client) GetAlbumOtherVersions(id string) ([]AlbumRespData, error) {
 	query := url.Values{}
-	query.Set("omit[resource]", "autos")
-	query.Set("include", "tracks,artists,record-labels")
-	query.Set("include[songs]", "artists")
-	//query.Set("fields[artists]", "name,artwork")
-	//query.Set("fields[albums:albums]", "artistName,artwork,name,releaseDate,url")
-	//query.Set("fields[record-labels]", "name")
-	query.Set("extend", "editorialVideo,extendedAssetUrls")
-	query.Set("l", language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
+	query.Set("l", c.Language)
+	obj := new(AlbumResp)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/albums/%s/view/other-versions", c.Storefront, id), query, obj)
 	if err != nil {
 		return nil, err
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
-	}
+	return obj.Data, nil
+}
+
+func (c *Client) getAlbum(path string) (*AlbumResp, error) {
 	obj := new(AlbumResp)
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	err := c.get(path, albumQuery(c.Language), obj)
 	if err != nil {
 		return nil, err
 	}
+	if len(obj.Data) == 0 {
+		return nil, errors.New("album not found")
+	}
 	if len(obj.Data[0].Relationships.Tracks.Next) > 0 {
-		next := obj.Data[0].Relationships.Tracks.Next
-		for {
-			req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com%s", next), nil)
-			if err != nil {
-				return nil, err
-			}
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-			req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-			req.Header.Set("Origin", "https://music.apple.com")
-			query := req.URL.Query()
-			query.Set("omit[resource]", "autos")
-			query.Set("include", "artists")
-			query.Set("extend", "editorialVideo,extendedAssetUrls")
-			req.URL.RawQuery = query.Encode()
-			do, err := http.DefaultClient.Do(req)
-			if err != nil {
-				return nil, err
-			}
-			defer do.Body.Close()
-			if do.StatusCode != http.StatusOK {
-				return nil, errors.New(do.Status)
-			}
-			obj2 := new(TrackResp)
-			err = json.NewDecoder(do.Body).Decode(&obj2)
-			if err != nil {
-				return nil, err
-			}
-			obj.Data[0].Relationships.Tracks.Data = append(obj.Data[0].Relationships.Tracks.Data, obj2.Data...)
-			next = obj2.Next
-			if len(next) == 0 {
-				break
-			}
+		tracks, err := c.getTracksNext(obj.Data[0].Relationships.Tracks.Next)
+		if err != nil {
+			return nil, err
 		}
+		obj.Data[0].Relationships.Tracks.Data = append(obj.Data[0].Relationships.Tracks.Data, tracks...)
+		obj.Data[0].Relationships.Tracks.Next = ""
 	}
 	return obj, nil
 }
@@ -0,0 +1,118 @@
+package ampapi
+
+import "testing"
+
+var albumRoutes = map[string]string{
+	"/v1/catalog/us/albums/1624945511":                     "album.json",
+	"/v1/catalog/us/albums/1624945511/tracks?offset=2":     "album_tracks_2.json",
+	"/v1/catalog/us/albums/1624945511/tracks?offset=4":     "album_tracks_4.json",
+	"/v1/catalog/us/songs/1624945512/albums":               "album.json",
+	"/v1/catalog/us/albums/1440818582/view/other-versions": "album_other_versions.json",
+}
+
+func TestGetAlbumRespFollowsTracksNext(t *testing.T) {
+	c := newFixtureServer(t, albumRoutes)
+	resp, err := c.GetAlbumResp("1624945511")
+	if err != nil {
+		t.Fatal(err)
+	}
+	album := resp.Data[0]
+	tracks := album.Relationships.Tracks
+	if len(tracks.Data) != 5 {
+		t.Fatalf("got %d tracks, want 5 across three pages", len(tracks.Data))
+	}
+	if tracks.Next != "" {
+		t.Errorf("Next = %q, want it cleared after pagination", tracks.Next)
+	}
+	wantIDs := []string{"1624945512", "1624945513", "1624945514", "1624945515", "1624945516"}
+	for i, id := range wantIDs {
+		if tracks.Data[i].ID != id {
+			t.Errorf("track %d ID = %s, want %s", i, tracks.Data[i].ID, id)
+		}
+	}
+	if tracks.Data[3].Type != "music-videos" {
+		t.Errorf("track 4 type = %s, want music-videos", tracks.Data[3].Type)
+	}
+	if last := tracks.Data[4].Attributes; last.DiscNumber != 2 || last.TrackNumber != 1 {
+		t.Errorf("last track disc/track = %d/%d, want 2/1", last.DiscNumber, last.TrackNumber)
+	}
+}
+
+func TestGetAlbumRespDecodesAttributes(t *testing.T) {
+	c := newFixtureServer(t, albumRoutes)
+	resp, err := c.GetAlbumResp("1624945511")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := resp.Data[0].Attributes
+	if attr.Name != "Whenever You Need Somebody (2022 Remaster)" || attr.ArtistName != "Rick Astley" {
+		t.Errorf("name/artist = %q/%q", attr.Name, attr.ArtistName)
+	}
+	if attr.Upc != "4050538793819" || attr.RecordLabel == "" || attr.Copyright == "" {
+		t.Errorf("upc/label/copyright not decoded: %+v", attr)
+	}
+	if attr.TrackCount != 5 || !attr.IsAppleDigitalMaster || attr.IsCompilation || attr.IsSingle {
+		t.Errorf("flags not decoded: trackCount=%d adm=%v", attr.TrackCount, attr.IsAppleDigitalMaster)
+	}
+	if attr.ReleaseDate != "1987-11-12" || len(attr.GenreNames) != 2 {
+		t.Errorf("releaseDate/genres = %q/%v", attr.ReleaseDate, attr.GenreNames)
+	}
+	if attr.EditorialVideo.MotionDetailSquare.Video == "" {
+		t.Error("editorialVideo.motionDetailSquare not decoded")
+	}
+	artists := resp.Data[0].Relationships.Artists.Data
+	if len(artists) != 1 || artists[0].ID != "669771" || artists[0].Attributes.Artwork.Url == "" {
+		t.Errorf("artists relationship not decoded: %+v", artists)
+	}
+
+	track := resp.Data[0].Relationships.Tracks.Data[0].Attributes
+	if track.Isrc != "GBARL9300135" || track.DurationInMillis != 213573 || track.ComposerName == "" {
+		t.Errorf("track attributes not decoded: %+v", track)
+	}
+	if track.ExtendedAssetUrls.EnhancedHls == "" || track.AudioLocale != "en-US" {
+		t.Errorf("extendedAssetUrls/audioLocale not decoded")
+	}
+}
+
+func TestGetAlbumRespDecodesClassicalAttributes(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/albums/1452400000": "album_classical.json"})
+	resp, err := c.GetAlbumResp("1452400000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	track := resp.Data[0].Relationships.Tracks.Data[1].Attributes
+	if track.WorkName != "Symphony No. 5 in C Minor, Op. 67" || track.MovementName != "Andante con moto" {
+		t.Errorf("work/movement = %q/%q", track.WorkName, track.MovementName)
+	}
+	if track.MovementNumber != 2 || track.MovementCount != 4 || track.Attribution == "" {
+		t.Errorf("movement %d of %d, attribution %q", track.MovementNumber, track.MovementCount, track.Attribution)
+	}
+}
+
+func TestGetAlbumRespByHref(t *testing.T) {
+	c := newFixtureServer(t, albumRoutes)
+	resp, err := c.GetAlbumRespByHref("/v1/catalog/us/songs/1624945512?l=en-US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[0].ID != "1624945511" || len(resp.Data[0].Relationships.Tracks.Data) != 5 {
+		t.Errorf("got album %s with %d tracks", resp.Data[0].ID, len(resp.Data[0].Relationships.Tracks.Data))
+	}
+}
+
+func TestGetAlbumOtherVersions(t *testing.T) {
+	c := newFixtureServer(t, albumRoutes)
+	versions, err := c.GetAlbumOtherVersions("1440818582")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(versions))
+	}
+	if v := versions[0]; v.ID != "1440650428" || v.Attributes.ContentRating != "clean" || v.Attributes.TrackCount != 12 {
+		t.Errorf("first version = %s %q %d", v.ID, v.Attributes.ContentRating, v.Attributes.TrackCount)
+	}
+	if _, err := c.GetAlbumOtherVersions("1"); err == nil {
+		t.Error("missing album returned no error")
+	}
+}
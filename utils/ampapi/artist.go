@@ -1 +1,89 @@
 package ampapi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+func GetArtistResp(storefront string, id string, language string, token string) (*ArtistResp, error) {
+	return NewClient(storefront, language, token).GetArtistResp(id)
+}
+
+func (c *Client) GetArtistResp(id string) (*ArtistResp, error) {
+	query := url.Values{}
+	query.Set("l", c.Language)
+	obj := new(ArtistResp)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/artists/%s", c.Storefront, id), query, obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.Data) == 0 {
+		return nil, errors.New("artist not found")
+	}
+	return obj, nil
+}
+
+func artistRelationshipQuery(language string, offset int) url.Values {
+	query := url.Values{}
+	query.Set("limit", "100")
+	query.Set("offset", fmt.Sprint(offset))
+	query.Set("l", language)
+	return query
+}
+
+// GetArtistAlbums pages through every album of an artist.
+func (c *Client) GetArtistAlbums(id string) ([]AlbumRespData, error) {
+	var albums []AlbumRespData
+	for offset := 0; ; offset += 100 {
+		obj := new(AlbumResp)
+		err := c.get(fmt.Sprintf("/v1/catalog/%s/artists/%s/albums", c.Storefront, id), artistRelationshipQuery(c.Language, offset), obj)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, obj.Data...)
+		if len(obj.Next) == 0 {
+			break
+		}
+	}
+	return albums, nil
+}
+
+// GetArtistMusicVideos pages through every music video of an artist.
+func (c *Client) GetArtistMusicVideos(id string) ([]MusicVideoRespData, error) {
+	var videos []MusicVideoRespData
+	for offset := 0; ; offset += 100 {
+		obj := new(MusicVideoResp)
+		err := c.get(fmt.Sprintf("/v1/catalog/%s/artists/%s/music-videos", c.Storefront, id), artistRelationshipQuery(c.Language, offset), obj)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, obj.Data...)
+		if len(obj.Next) == 0 {
+			break
+		}
+	}
+	return videos, nil
+}
+
+type ArtistResp struct {
+	Href string           `json:"href"`
+	Next string           `json:"next"`
+	Data []ArtistRespData `json:"data"`
+}
+
+type ArtistRespData struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Href       string `json:"href"`
+	Attributes struct {
+		Name       string   `json:"name"`
+		GenreNames []string `json:"genreNames"`
+		URL        string   `json:"url"`
+		Artwork    struct {
+			Width  int    `json:"width"`
+			Height int    `json:"height"`
+			URL    string `json:"url"`
+		} `json:"artwork"`
+	} `json:"attributes"`
+}
@@ -0,0 +1,20 @@
+package ampapi
+
+import "testing"
+
+func TestGetArtistAlbumsPaging(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{
+		"/v1/catalog/us/artists/669771/albums?offset=0":   "artist_albums_0.json",
+		"/v1/catalog/us/artists/669771/albums?offset=100": "artist_albums_100.json",
+	})
+	albums, err := c.GetArtistAlbums("669771")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 2 || albums[0].ID != "1624945511" || albums[1].ID != "1549087516" {
+		t.Fatalf("got %+v", albums)
+	}
+	if albums[1].Attributes.TrackCount != 12 || albums[1].Attributes.ReleaseDate != "2016-06-10" {
+		t.Errorf("attributes not decoded: %+v", albums[1].Attributes)
+	}
+}
@@ -0,0 +1,146 @@
+package ampapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultBaseURL = "https://amp-api.music.apple.com"
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// Client talks to the Apple Music catalog API.
+// The zero value of BaseURL and HTTPClient fall back to DefaultBaseURL and http.DefaultClient.
+type Client struct {
+	BaseURL    string
+	Storefront string
+	Language   string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// DefaultClient holds the base URL and http.Client copied into every client created by NewClient.
+// Point it somewhere else to redirect the whole tool, e.g. to a local fixture server.
+var DefaultClient = &Client{
+	BaseURL:    DefaultBaseURL,
+	HTTPClient: http.DefaultClient,
+}
+
+func NewClient(storefront string, language string, token string) *Client {
+	return &Client{
+		BaseURL:    DefaultClient.BaseURL,
+		Storefront: storefront,
+		Language:   language,
+		Token:      token,
+		HTTPClient: DefaultClient.HTTPClient,
+	}
+}
+
+// WithStorefront returns a copy of the client bound to another storefront.
+func (c *Client) WithStorefront(storefront string) *Client {
+	n := *c
+	n.Storefront = storefront
+	return &n
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimSuffix(c.BaseURL, "/")
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) token() (string, error) {
+	if c.Token == "" {
+		token, err := GetToken()
+		if err != nil {
+			return "", err
+		}
+		c.Token = token
+	}
+	return c.Token, nil
+}
+
+// newRequest builds a request for path (relative to BaseURL, may carry its own query)
+// with the headers shared by every catalog call. Values in query are merged into the URL.
+func (c *Client) newRequest(method string, path string, query url.Values) (*http.Request, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, c.baseURL()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Origin", "https://music.apple.com")
+	if query != nil {
+		q := req.URL.Query()
+		for k, v := range query {
+			q[k] = v
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	return req, nil
+}
+
+// StatusError is returned when the API answers with anything but 200 OK.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// do sends req and decodes a 200 response body into obj.
+func (c *Client) do(req *http.Request, obj interface{}) error {
+	do, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer do.Body.Close()
+	if do.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: do.StatusCode, Status: do.Status}
+	}
+	return json.NewDecoder(do.Body).Decode(obj)
+}
+
+func (c *Client) get(path string, query url.Values, obj interface{}) error {
+	req, err := c.newRequest("GET", path, query)
+	if err != nil {
+		return err
+	}
+	return c.do(req, obj)
+}
+
+// getTracksNext follows a tracks relationship "next" href until it is exhausted.
+func (c *Client) getTracksNext(next string) ([]TrackRespData, error) {
+	var tracks []TrackRespData
+	for len(next) > 0 {
+		query := url.Values{}
+		query.Set("omit[resource]", "autos")
+		query.Set("include", "artists")
+		query.Set("extend", "editorialVideo,extendedAssetUrls")
+		obj := new(TrackResp)
+		err := c.get(next, query, obj)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, obj.Data...)
+		next = obj.Next
+	}
+	return tracks, nil
+}
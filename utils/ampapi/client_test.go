@@ -0,0 +1,121 @@
+package ampapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testToken = "test-token"
+
+// newFixtureServer serves canned catalog responses from testdata.
+// Routes are keyed by request path, or by "path?offset=N" for paginated requests.
+// Any other path answers 404 Not Found.
+func newFixtureServer(t *testing.T, routes map[string]string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		key := r.URL.Path
+		if offset := r.URL.Query().Get("offset"); offset != "" {
+			key += "?offset=" + offset
+		}
+		name, ok := routes[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if code, ok := statusFixtures[name]; ok {
+			w.WriteHeader(code)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("read fixture %s: %v", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient("us", "en-US", testToken)
+	c.BaseURL = srv.URL
+	c.HTTPClient = srv.Client()
+	return c
+}
+
+// statusFixtures lets a route answer with a bare status code instead of a file.
+var statusFixtures = map[string]int{
+	"status:401": http.StatusUnauthorized,
+	"status:404": http.StatusNotFound,
+	"status:429": http.StatusTooManyRequests,
+	"status:500": http.StatusInternalServerError,
+}
+
+func TestClientStatusErrors(t *testing.T) {
+	for _, code := range []int{401, 404, 429, 500} {
+		c := newFixtureServer(t, map[string]string{
+			"/v1/catalog/us/songs/1": fmt.Sprintf("status:%d", code),
+		})
+		_, err := c.GetSongResp("1")
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("status %d: got error %v, want *StatusError", code, err)
+		}
+		if statusErr.StatusCode != code {
+			t.Errorf("StatusCode = %d, want %d", statusErr.StatusCode, code)
+		}
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/songs/1624945512": "song.json"})
+	c.Token = "expired"
+	_, err := c.GetSongResp("1624945512")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got error %v, want 401", err)
+	}
+}
+
+func TestClientStatusErrorOnPagination(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{
+		"/v1/catalog/us/albums/1624945511":                 "album.json",
+		"/v1/catalog/us/albums/1624945511/tracks?offset=2": "album_tracks_2.json",
+		"/v1/catalog/us/albums/1624945511/tracks?offset=4": "status:500",
+	})
+	_, err := c.GetAlbumResp("1624945511")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got error %v, want 500 from the last tracks page", err)
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	c := newFixtureServer(t, nil)
+	if _, err := c.GetAlbumResp("0"); err == nil {
+		t.Fatal("expected an error for an unknown album")
+	}
+}
+
+func TestDefaultClientIsCopied(t *testing.T) {
+	saved := *DefaultClient
+	defer func() { *DefaultClient = saved }()
+
+	DefaultClient.BaseURL = "http://127.0.0.1:1"
+	c := NewClient("jp", "ja", testToken)
+	if c.BaseURL != "http://127.0.0.1:1" || c.Storefront != "jp" || c.Language != "ja" {
+		t.Errorf("NewClient did not pick up DefaultClient: %+v", c)
+	}
+	if other := c.WithStorefront("us"); other.Storefront != "us" || c.Storefront != "jp" {
+		t.Errorf("WithStorefront changed the original client")
+	}
+}
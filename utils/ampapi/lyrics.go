@@ -0,0 +1,50 @@
+package ampapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GetLyrics fetches the TTML of a song's lyrics. lrcType is "lyrics" or "syllable-lyrics"; the
+// endpoint needs the account's media-user-token besides the catalog token.
+func (c *Client) GetLyrics(id string, lrcType string, mediaUserToken string) (string, error) {
+	query := url.Values{}
+	query.Set("l", c.Language)
+	query.Set("extend", "ttmlLocalizations")
+	req, err := c.newRequest("GET", fmt.Sprintf("/v1/catalog/%s/songs/%s/%s", c.Storefront, id, lrcType), query)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Referer", "https://music.apple.com/")
+	req.AddCookie(&http.Cookie{Name: "media-user-token", Value: mediaUserToken})
+	obj := new(LyricsResp)
+	if err := c.do(req, obj); err != nil {
+		return "", err
+	}
+	if len(obj.Data) == 0 {
+		return "", errors.New("failed to get lyrics")
+	}
+	if len(obj.Data[0].Attributes.Ttml) > 0 {
+		return obj.Data[0].Attributes.Ttml, nil
+	}
+	return obj.Data[0].Attributes.TtmlLocalizations, nil
+}
+
+type LyricsResp struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			Ttml              string `json:"ttml"`
+			TtmlLocalizations string `json:"ttmlLocalizations"`
+			PlayParams        struct {
+				ID          string `json:"id"`
+				Kind        string `json:"kind"`
+				CatalogID   string `json:"catalogId"`
+				DisplayType int    `json:"displayType"`
+			} `json:"playParams"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
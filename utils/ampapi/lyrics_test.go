@@ -0,0 +1,23 @@
+package ampapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetLyrics(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{
+		"/v1/catalog/us/songs/1624945512/syllable-lyrics": "lyrics.json",
+		"/v1/catalog/us/songs/1/syllable-lyrics":          "status:404",
+	})
+	ttml, err := c.GetLyrics("1624945512", "syllable-lyrics", "user-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(ttml, "Never gonna give you up") {
+		t.Errorf("ttmlLocalizations not used: %q", ttml)
+	}
+	if _, err := c.GetLyrics("1", "syllable-lyrics", "user-token"); err == nil {
+		t.Error("missing lyrics did not fail")
+	}
+}
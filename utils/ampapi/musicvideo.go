@@ -1,29 +1,16 @@
 package ampapi
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 )
 
 func GetMusicVideoResp(storefront string, id string, language string, token string) (*MusicVideoResp, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return nil, err
-		}
-	}
+	return NewClient(storefront, language, token).GetMusicVideoResp(id)
+}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com/v1/catalog/%s/music-videos/%s", storefront, id), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
+func (c *Client) GetMusicVideoResp(id string) (*MusicVideoResp, error) {
 	query := url.Values{}
 	//query.Set("omit[resource]", "autos")
 	query.Set("include", "albums,artists")
@@ -33,21 +20,15 @@ func GetMusicVideoResp(storefront string, id string, language string, token stri
 	//query.Set("fields[albums:albums]", "artistName,artwork,name,releaseDate,url")
 	//query.Set("fields[record-labels]", "name")
 	//query.Set("extend", "editorialVideo")
-	query.Set("l", language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
-	}
+	query.Set("l", c.Language)
 	obj := new(MusicVideoResp)
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/music-videos/%s", c.Storefront, id), query, obj)
 	if err != nil {
 		return nil, err
 	}
+	if len(obj.Data) == 0 {
+		return nil, errors.New("music video not found")
+	}
 	return obj, nil
 }
 
@@ -0,0 +1,18 @@
+package ampapi
+
+import "testing"
+
+func TestGetMusicVideoResp(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/music-videos/1558533900": "musicvideo.json"})
+	resp, err := c.GetMusicVideoResp("1558533900")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := resp.Data[0].Attributes
+	if attr.Name != "Never Gonna Give You Up" || attr.Isrc != "GBARL8700123" || !attr.Has4K {
+		t.Errorf("attributes not decoded: %+v", attr)
+	}
+	if len(attr.GenreNames) != 1 || attr.Artwork.URL == "" {
+		t.Errorf("genres/artwork not decoded")
+	}
+}
@@ -0,0 +1,28 @@
+package ampapi
+
+import "testing"
+
+func TestGetPlaylistRespFollowsTracksNext(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{
+		"/v1/catalog/us/playlists/pl.3950454ced8c45a3b0cc693c2a7db97b":                   "playlist.json",
+		"/v1/catalog/us/playlists/pl.3950454ced8c45a3b0cc693c2a7db97b/tracks?offset=100": "playlist_tracks_100.json",
+	})
+	resp, err := c.GetPlaylistResp("pl.3950454ced8c45a3b0cc693c2a7db97b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := resp.Data[0]
+	if playlist.Attributes.Name != "Taylor Swift Essentials" {
+		t.Errorf("name = %q", playlist.Attributes.Name)
+	}
+	tracks := playlist.Relationships.Tracks.Data
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	if tracks[0].Attributes.Name != "Shake It Off" || tracks[1].Attributes.Name != "Love Story" {
+		t.Errorf("tracks out of order: %s, %s", tracks[0].Attributes.Name, tracks[1].Attributes.Name)
+	}
+	if tracks[1].Attributes.AlbumName != "Fearless" || tracks[1].Attributes.Isrc != "USCJY0803275" {
+		t.Errorf("second page attributes not decoded: %+v", tracks[1].Attributes)
+	}
+}
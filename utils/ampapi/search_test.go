@@ -0,0 +1,53 @@
+package ampapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSearchPaging(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{
+		"/v1/catalog/us/search?offset=0": "search_0.json",
+		"/v1/catalog/us/search?offset=2": "search_2.json",
+	})
+	var names []string
+	offset := 0
+	for {
+		resp, err := c.Search("astley", "albums", 2, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Results.Albums == nil {
+			t.Fatal("albums missing from search results")
+		}
+		if resp.Results.Songs != nil || resp.Results.Artists != nil {
+			t.Error("unexpected songs/artists in album search")
+		}
+		for _, album := range resp.Results.Albums.Data {
+			names = append(names, album.Attributes.Name)
+		}
+		if resp.Results.Albums.Next == "" {
+			break
+		}
+		offset += 2
+	}
+	want := "Whenever You Need Somebody (2022 Remaster)|Hold Me in Your Arms|50"
+	if got := strings.Join(names, "|"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSearchStatusError(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{
+		"/v1/catalog/us/search?offset=0": "status:429",
+	})
+	_, err := c.Search("astley", "albums", 2, 0)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 429 {
+		t.Fatalf("got error %v, want wrapped 429", err)
+	}
+	if !strings.HasPrefix(err.Error(), "API request failed with status:") {
+		t.Errorf("error message = %q", err.Error())
+	}
+}
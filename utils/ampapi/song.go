@@ -1,29 +1,16 @@
 package ampapi
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 )
 
 func GetSongResp(storefront string, id string, language string, token string) (*SongResp, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return nil, err
-		}
-	}
+	return NewClient(storefront, language, token).GetSongResp(id)
+}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com/v1/catalog/%s/songs/%s", storefront, id), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
+func (c *Client) GetSongResp(id string) (*SongResp, error) {
 	query := url.Values{}
 	//query.Set("omit[resource]", "autos")
 	query.Set("include", "albums,artists")
@@ -33,21 +20,54 @@ func GetSongResp(storefront string, id string, language string, token string) (*
 	//query.Set("fields[albums:albums]", "artistName,artwork,name,releaseDate,url")
 	//query.Set("fields[record-labels]", "name")
 	//query.Set("extend", "editorialVideo")
-	query.Set("l", language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
+	query.Set("l", c.Language)
+	obj := new(SongResp)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/songs/%s", c.Storefront, id), query, obj)
 	if err != nil {
 		return nil, err
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
+	if len(obj.Data) == 0 {
+		return nil, errors.New("song not found")
 	}
+	return obj, nil
+}
+
+// GetTrackResp looks up a song with its albums and artists decoded as a TrackRespData, e.g. to
+// replace a track taken from an album's tracks relationship, which carries no relationships.
+func (c *Client) GetTrackResp(id string) (*TrackRespData, error) {
+	query := url.Values{}
+	query.Set("include", "albums,artists")
+	query.Set("extend", "extendedAssetUrls")
+	query.Set("l", c.Language)
+	obj := new(TrackResp)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/songs/%s", c.Storefront, id), query, obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(obj.Data) == 0 {
+		return nil, errors.New("song not found")
+	}
+	return &obj.Data[0], nil
+}
+
+// GetSongsByIsrc looks up the songs with the given ISRC, e.g. to identify a file that has no catalog ID.
+func GetSongsByIsrc(storefront string, isrc string, language string, token string) (*SongResp, error) {
+	return NewClient(storefront, language, token).GetSongsByIsrc(isrc)
+}
+
+func (c *Client) GetSongsByIsrc(isrc string) (*SongResp, error) {
+	query := url.Values{}
+	query.Set("filter[isrc]", isrc)
+	query.Set("include", "albums,artists")
+	query.Set("l", c.Language)
 	obj := new(SongResp)
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/songs", c.Storefront), query, obj)
 	if err != nil {
 		return nil, err
 	}
+	if len(obj.Data) == 0 {
+		return nil, errors.New("song not found")
+	}
 	return obj, nil
 }
 
@@ -100,6 +120,12 @@ type SongRespData struct {
 		TrackNumber  int    `json:"trackNumber"`
 		AudioLocale  string `json:"audioLocale"`
 		ComposerName string `json:"composerName"`
+		// classical releases only
+		WorkName       string `json:"workName"`
+		MovementName   string `json:"movementName"`
+		MovementNumber int    `json:"movementNumber"`
+		MovementCount  int    `json:"movementCount"`
+		Attribution    string `json:"attribution"`
 	} `json:"attributes"`
 	Relationships struct {
 		Artists struct {
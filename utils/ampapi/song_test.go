@@ -0,0 +1,53 @@
+package ampapi
+
+import "testing"
+
+func TestGetSongResp(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/songs/1624945512": "song.json"})
+	resp, err := c.GetSongResp("1624945512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	song := resp.Data[0]
+	if song.Attributes.Name != "Never Gonna Give You Up" || song.Attributes.ExtendedAssetUrls.EnhancedHls == "" {
+		t.Errorf("attributes not decoded: %+v", song.Attributes)
+	}
+	albums := song.Relationships.Albums.Data
+	if len(albums) != 1 || albums[0].ID != "1624945511" || albums[0].Attributes.Upc != "4050538793819" {
+		t.Errorf("albums relationship not decoded: %+v", albums)
+	}
+	if len(song.Relationships.Artists.Data) != 1 {
+		t.Errorf("artists relationship not decoded")
+	}
+}
+
+func TestGetTrackResp(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/songs/1624945512": "song.json"})
+	track, err := c.GetTrackResp("1624945512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.Attributes.ExtendedAssetUrls.EnhancedHls == "" || track.Attributes.Isrc != "GBARL9300135" {
+		t.Errorf("attributes not decoded: %+v", track.Attributes)
+	}
+	if albums := track.Relationships.Albums.Data; len(albums) != 1 || albums[0].ID != "1624945511" {
+		t.Errorf("albums relationship not decoded: %+v", albums)
+	}
+	if len(track.Relationships.Artists.Data) != 1 {
+		t.Errorf("artists relationship not decoded")
+	}
+}
+
+func TestGetSongsByIsrc(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/songs": "song.json"})
+	resp, err := c.GetSongsByIsrc("GBARL9300135")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[0].ID != "1624945512" || len(resp.Data[0].Relationships.Albums.Data) != 1 {
+		t.Errorf("songs not decoded: %+v", resp.Data)
+	}
+	if _, err := newFixtureServer(t, nil).GetSongsByIsrc("GBARL9300135"); err == nil {
+		t.Error("missing song did not fail")
+	}
+}
@@ -1,125 +1,77 @@
 package ampapi
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 )
 
 func GetStationResp(storefront string, id string, language string, token string) (*StationResp, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return nil, err
-		}
-	}
+	return NewClient(storefront, language, token).GetStationResp(id)
+}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://amp-api.music.apple.com/v1/catalog/%s/stations/%s", storefront, id), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
+func GetStationAssetsUrlAndServerUrl(id string, mutoken string, token string) (string, string, error) {
+	return NewClient("", "", token).GetStationAssetsUrlAndServerUrl(id, mutoken)
+}
+
+func GetStationNextTracks(id, mutoken, language, token string) (*TrackResp, error) {
+	return NewClient("", language, token).GetStationNextTracks(id, mutoken)
+}
+
+func (c *Client) GetStationResp(id string) (*StationResp, error) {
 	query := url.Values{}
 	query.Set("omit[resource]", "autos")
 	query.Set("extend", "editorialVideo")
-	query.Set("l", language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
-	}
+	query.Set("l", c.Language)
 	obj := new(StationResp)
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	err := c.get(fmt.Sprintf("/v1/catalog/%s/stations/%s", c.Storefront, id), query, obj)
 	if err != nil {
 		return nil, err
 	}
+	if len(obj.Data) == 0 {
+		return nil, errors.New("station not found")
+	}
 	return obj, nil
 }
 
-func GetStationAssetsUrlAndServerUrl(id string, mutoken string, token string) (string, string, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return "", "", err
-		}
-	}
-
-	req, err := http.NewRequest("GET", "https://amp-api.music.apple.com/v1/play/assets", nil)
-	if err != nil {
-		return "", "", err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
-	req.Header.Set("Media-User-Token", mutoken)
+func (c *Client) GetStationAssetsUrlAndServerUrl(id string, mutoken string) (string, string, error) {
 	query := url.Values{}
 	//query.Set("omit[resource]", "autos")
 	//query.Set("extend", "editorialVideo")
 	query.Set("id", id)
 	query.Set("kind", "radioStation")
 	query.Set("keyFormat", "web")
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
+	req, err := c.newRequest("GET", "/v1/play/assets", query)
 	if err != nil {
 		return "", "", err
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return "", "", errors.New(do.Status)
-	}
+	req.Header.Set("Media-User-Token", mutoken)
 	obj := new(StationAssets)
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	err = c.do(req, obj)
 	if err != nil {
 		return "", "", err
 	}
+	if len(obj.Results.Assets) == 0 {
+		return "", "", errors.New("no station assets")
+	}
 	return obj.Results.Assets[0].Url, obj.Results.Assets[0].KeyServerUrl, nil
 }
 
-func GetStationNextTracks(id, mutoken, language, token string) (*TrackResp, error) {
-	var err error
-	if token == "" {
-		token, err = GetToken()
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://amp-api.music.apple.com/v1/me/stations/next-tracks/%s", id), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Origin", "https://music.apple.com")
-	req.Header.Set("Media-User-Token", mutoken)
+func (c *Client) GetStationNextTracks(id, mutoken string) (*TrackResp, error) {
 	query := url.Values{}
 	query.Set("omit[resource]", "autos")
 	//query.Set("include", "tracks,artists,record-labels")
 	query.Set("include[songs]", "artists,albums")
 	query.Set("limit", "10")
 	query.Set("extend", "editorialVideo,extendedAssetUrls")
-	query.Set("l", language)
-	req.URL.RawQuery = query.Encode()
-	do, err := http.DefaultClient.Do(req)
+	query.Set("l", c.Language)
+	req, err := c.newRequest("POST", fmt.Sprintf("/v1/me/stations/next-tracks/%s", id), query)
 	if err != nil {
 		return nil, err
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
-	}
+	req.Header.Set("Media-User-Token", mutoken)
 	obj := new(TrackResp)
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	err = c.do(req, obj)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,15 @@
+package ampapi
+
+import "testing"
+
+func TestGetStationResp(t *testing.T) {
+	c := newFixtureServer(t, map[string]string{"/v1/catalog/us/stations/ra.978194965": "station.json"})
+	resp, err := c.GetStationResp("ra.978194965")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := resp.Data[0].Attributes
+	if attr.Name != "Apple Music 1" || !attr.IsLive || attr.PlayParams.Format != "stream" {
+		t.Errorf("attributes not decoded: %+v", attr)
+	}
+}
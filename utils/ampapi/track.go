@@ -50,6 +50,12 @@ type TrackRespData struct {
 		TrackNumber  int    `json:"trackNumber"`
 		AudioLocale  string `json:"audioLocale"`
 		ComposerName string `json:"composerName"`
+		// classical releases only
+		WorkName       string `json:"workName"`
+		MovementName   string `json:"movementName"`
+		MovementNumber int    `json:"movementNumber"`
+		MovementCount  int    `json:"movementCount"`
+		Attribution    string `json:"attribution"`
 	} `json:"attributes"`
 	Relationships struct {
 		Artists struct {
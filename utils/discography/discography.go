@@ -0,0 +1,185 @@
+// Package discography narrows an artist's album list down to the releases the user asked for.
+package discography
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"main/utils/ampapi"
+)
+
+// Types are the album types Type returns, in the order they are checked.
+var Types = []string{"compilation", "ep", "single", "live", "album"}
+
+var liveName = regexp.MustCompile(`(?i)([(\[]live\b|\s-\s+live\b|^live (at|from|in)\b)`)
+
+// Type classifies an album as "compilation", "ep", "single", "live" or "album".
+func Type(a *ampapi.AlbumRespData) string {
+	switch {
+	case a.Attributes.IsCompilation:
+		return "compilation"
+	case strings.HasSuffix(a.Attributes.Name, " - EP"):
+		return "ep"
+	case a.Attributes.IsSingle || strings.HasSuffix(a.Attributes.Name, " - Single"):
+		return "single"
+	case liveName.MatchString(a.Attributes.Name):
+		return "live"
+	}
+	return "album"
+}
+
+var (
+	typeSuffix = regexp.MustCompile(`\s+-\s+(Single|EP)$`)
+	editionTag = regexp.MustCompile(`(?i)\s*[(\[][^)\]]*\b(deluxe|edition|remaster(ed)?|expanded|anniversary|bonus|special|platinum)\b[^)\]]*[)\]]\s*$`)
+)
+
+// BaseTitle strips the edition tags from an album name, e.g. "1989 (Deluxe Edition)" becomes "1989".
+func BaseTitle(name string) string {
+	name = typeSuffix.ReplaceAllString(name, "")
+	for {
+		base := editionTag.ReplaceAllString(name, "")
+		if base == name || base == "" {
+			return strings.TrimSpace(name)
+		}
+		name = base
+	}
+}
+
+// ParseYears parses a release-year range: "2012", "2010-2015", "2010-" or "-2015".
+// Zero stands for an open end.
+func ParseYears(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	fromStr, toStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		toStr = fromStr
+	}
+	var years [2]int
+	for i, part := range []string{fromStr, toStr} {
+		if part == "" {
+			continue
+		}
+		year, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid year range %q", s)
+		}
+		years[i] = year
+	}
+	if years[0] != 0 && years[1] != 0 && years[0] > years[1] {
+		return 0, 0, fmt.Errorf("invalid year range %q", s)
+	}
+	return years[0], years[1], nil
+}
+
+// Filter selects albums. The zero Filter keeps everything.
+type Filter struct {
+	Types    []string       // album types to keep, see Type; empty keeps all
+	Rating   string         // "explicit" or "clean": drop the other version when both exist
+	YearFrom int            // first release year to keep, 0 for no limit
+	YearTo   int            // last release year to keep, 0 for no limit
+	Name     *regexp.Regexp // keep only matching names
+	Collapse bool           // keep one edition per base title, the one with the most tracks
+}
+
+// Keep reports whether a release with this name and release date passes the year and name filters.
+func (f Filter) Keep(name, releaseDate string) bool {
+	if f.Name != nil && !f.Name.MatchString(name) {
+		return false
+	}
+	if f.YearFrom == 0 && f.YearTo == 0 {
+		return true
+	}
+	year, err := strconv.Atoi(strings.SplitN(releaseDate, "-", 2)[0])
+	if err != nil {
+		return false
+	}
+	return (f.YearFrom == 0 || year >= f.YearFrom) && (f.YearTo == 0 || year <= f.YearTo)
+}
+
+// Albums returns the albums that pass the filter, in their original order.
+func (f Filter) Albums(albums []ampapi.AlbumRespData) []ampapi.AlbumRespData {
+	var kept []*ampapi.AlbumRespData
+	for i := range albums {
+		a := &albums[i]
+		if len(f.Types) > 0 && !contains(f.Types, Type(a)) {
+			continue
+		}
+		if !f.Keep(a.Attributes.Name, a.Attributes.ReleaseDate) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	if f.Rating != "" {
+		kept = f.preferRating(kept)
+	}
+	if f.Collapse {
+		kept = f.collapse(kept)
+	}
+	result := make([]ampapi.AlbumRespData, len(kept))
+	for i, a := range kept {
+		result[i] = *a
+	}
+	return result
+}
+
+// preferRating drops the explicit or clean version of an album when the preferred one is also
+// listed. Albums without a counterpart are kept whatever their rating.
+func (f Filter) preferRating(albums []*ampapi.AlbumRespData) []*ampapi.AlbumRespData {
+	other := "clean"
+	if f.Rating == "clean" {
+		other = "explicit"
+	}
+	preferred := map[string]bool{}
+	for _, a := range albums {
+		if a.Attributes.ContentRating != other {
+			preferred[versionKey(a)] = true
+		}
+	}
+	var kept []*ampapi.AlbumRespData
+	for _, a := range albums {
+		if a.Attributes.ContentRating == other && preferred[versionKey(a)] {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// collapse keeps the edition with the most tracks of every base title and type. Ties go to
+// the preferred rating, then to the earlier entry.
+func (f Filter) collapse(albums []*ampapi.AlbumRespData) []*ampapi.AlbumRespData {
+	best := map[string]*ampapi.AlbumRespData{}
+	for _, a := range albums {
+		key := Type(a) + "\x00" + strings.ToLower(BaseTitle(a.Attributes.Name))
+		b, ok := best[key]
+		if !ok || a.Attributes.TrackCount > b.Attributes.TrackCount ||
+			(a.Attributes.TrackCount == b.Attributes.TrackCount && f.Rating != "" &&
+				a.Attributes.ContentRating == f.Rating && b.Attributes.ContentRating != f.Rating) {
+			best[key] = a
+		}
+	}
+	var kept []*ampapi.AlbumRespData
+	for _, a := range albums {
+		if best[Type(a)+"\x00"+strings.ToLower(BaseTitle(a.Attributes.Name))] == a {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// versionKey groups the explicit and clean versions of one album, which share name and type.
+func versionKey(a *ampapi.AlbumRespData) string {
+	return Type(a) + "\x00" + strings.ToLower(a.Attributes.Name)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
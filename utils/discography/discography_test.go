@@ -0,0 +1,95 @@
+package discography
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"main/utils/ampapi"
+)
+
+const albumsJSON = `[
+	{"id": "1", "attributes": {"name": "Red", "releaseDate": "2012-10-22", "trackCount": 16, "contentRating": "explicit"}},
+	{"id": "2", "attributes": {"name": "Red", "releaseDate": "2012-10-22", "trackCount": 16, "contentRating": "clean"}},
+	{"id": "3", "attributes": {"name": "Red (Deluxe Edition)", "releaseDate": "2012-10-22", "trackCount": 22, "contentRating": "explicit"}},
+	{"id": "4", "attributes": {"name": "Begin Again - Single", "releaseDate": "2012-09-25", "trackCount": 1, "isSingle": true}},
+	{"id": "5", "attributes": {"name": "The 1989 World Tour (Live)", "releaseDate": "2015-12-20", "trackCount": 13}},
+	{"id": "6", "attributes": {"name": "Christmas Tree Farm - EP", "releaseDate": "2019-12-06", "trackCount": 3}},
+	{"id": "7", "attributes": {"name": "Greatest Hits", "releaseDate": "2009-01-01", "trackCount": 20, "isCompilation": true}},
+	{"id": "8", "attributes": {"name": "Speak Now", "releaseDate": "2010-10-25", "trackCount": 14}}
+]`
+
+func albums(t *testing.T) []ampapi.AlbumRespData {
+	t.Helper()
+	var albums []ampapi.AlbumRespData
+	if err := json.Unmarshal([]byte(albumsJSON), &albums); err != nil {
+		t.Fatal(err)
+	}
+	return albums
+}
+
+func ids(albums []ampapi.AlbumRespData) string {
+	s := ""
+	for _, a := range albums {
+		s += a.ID
+	}
+	return s
+}
+
+func TestType(t *testing.T) {
+	want := []string{"album", "album", "album", "single", "live", "ep", "compilation", "album"}
+	for i, a := range albums(t) {
+		if got := Type(&a); got != want[i] {
+			t.Errorf("Type(%q) = %q, want %q", a.Attributes.Name, got, want[i])
+		}
+	}
+}
+
+func TestBaseTitle(t *testing.T) {
+	for name, want := range map[string]string{
+		"Red (Deluxe Edition)":                           "Red",
+		"Abbey Road (Remastered) [Super Deluxe Edition]": "Abbey Road",
+		"Begin Again - Single":                           "Begin Again",
+		"1989 (Taylor's Version)":                        "1989 (Taylor's Version)",
+		"(Deluxe)":                                       "(Deluxe)",
+	} {
+		if got := BaseTitle(name); got != want {
+			t.Errorf("BaseTitle(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseYears(t *testing.T) {
+	for s, want := range map[string][2]int{"": {0, 0}, "2012": {2012, 2012}, "2010-2015": {2010, 2015}, "2010-": {2010, 0}, "-2015": {0, 2015}} {
+		from, to, err := ParseYears(s)
+		if err != nil || from != want[0] || to != want[1] {
+			t.Errorf("ParseYears(%q) = %d, %d, %v", s, from, to, err)
+		}
+	}
+	for _, s := range []string{"20x0", "2015-2010"} {
+		if _, _, err := ParseYears(s); err == nil {
+			t.Errorf("ParseYears(%q) accepted", s)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"zero", Filter{}, "12345678"},
+		{"types", Filter{Types: []string{"album", "ep"}}, "12368"},
+		{"years", Filter{YearFrom: 2010, YearTo: 2012}, "12348"},
+		{"name", Filter{Name: regexp.MustCompile(`(?i)^red\b`)}, "123"},
+		{"explicit", Filter{Rating: "explicit"}, "1345678"},
+		{"clean", Filter{Rating: "clean"}, "2345678"},
+		{"collapse", Filter{Collapse: true}, "345678"},
+		{"collapse clean", Filter{Collapse: true, Rating: "clean", YearTo: 2012, Types: []string{"album"}}, "38"},
+	} {
+		if got := ids(tt.filter.Albums(albums(t))); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is one finished track. Entries are appended to the history file as JSON lines.
+type Entry struct {
+	ID      string    `json:"id"`
+	ISRC    string    `json:"isrc,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Codec   string    `json:"codec"`
+	Quality string    `json:"quality,omitempty"`
+	Path    string    `json:"path"`
+	PreType string    `json:"preType,omitempty"` // albums, playlists or stations
+	PreID   string    `json:"preId,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Store is an append-only download history backed by a JSON-lines file.
+// A nil *Store is valid and behaves as an empty, disabled history.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	entries []Entry
+	byID    map[string][]int
+	byISRC  map[string][]int
+}
+
+// Open loads the history file at path, creating it on the first Add.
+// Lines that fail to decode are skipped so a torn write never locks the user out.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		byID:   make(map[string][]int),
+		byISRC: make(map[string][]int),
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.ID == "" {
+			continue
+		}
+		s.index(e)
+	}
+	return s, scanner.Err()
+}
+
+func (s *Store) index(e Entry) {
+	i := len(s.entries)
+	s.entries = append(s.entries, e)
+	s.byID[e.ID] = append(s.byID[e.ID], i)
+	if e.ISRC != "" {
+		s.byISRC[e.ISRC] = append(s.byISRC[e.ISRC], i)
+	}
+}
+
+// Add records e and appends it to the history file.
+func (s *Store) Add(e Entry) error {
+	if s == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if abs, err := filepath.Abs(e.Path); err == nil {
+		e.Path = abs
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.index(e)
+	return nil
+}
+
+// Query selects history entries. Empty fields match anything; ID and ISRC match either.
+type Query struct {
+	ID      string
+	ISRC    string
+	Codec   string
+	PreType string
+	PreID   string
+}
+
+func (q Query) match(e Entry) bool {
+	return (q.Codec == "" || e.Codec == q.Codec) &&
+		(q.PreType == "" || e.PreType == q.PreType) &&
+		(q.PreID == "" || e.PreID == q.PreID)
+}
+
+// Find returns the most recent entry matching q, preferring a catalog ID match over an ISRC match.
+func (s *Store) Find(q Query) (Entry, bool) {
+	if s == nil {
+		return Entry{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q.ID == "" && q.ISRC == "" {
+		for i := len(s.entries) - 1; i >= 0; i-- {
+			if q.match(s.entries[i]) {
+				return s.entries[i], true
+			}
+		}
+		return Entry{}, false
+	}
+	if q.ID != "" {
+		if e, ok := s.latest(s.byID[q.ID], q); ok {
+			return e, true
+		}
+	}
+	if q.ISRC != "" {
+		return s.latest(s.byISRC[q.ISRC], q)
+	}
+	return Entry{}, false
+}
+
+func (s *Store) latest(indexes []int, q Query) (Entry, bool) {
+	for i := len(indexes) - 1; i >= 0; i-- {
+		e := s.entries[indexes[i]]
+		if q.match(e) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
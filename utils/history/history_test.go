@@ -0,0 +1,63 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorePersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Find(Query{ID: "1"}); ok {
+		t.Fatal("empty history returned an entry")
+	}
+	if err := s.Add(Entry{ID: "1", ISRC: "USAAA0000001", Codec: "ALAC", Path: "a/01. One.m4a", PreType: "albums", PreID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Entry{ID: "2", ISRC: "USAAA0000002", Codec: "ATMOS", Path: "b/02. Two.m4a", PreType: "playlists", PreID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a torn trailing line must not prevent loading the rest
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"3","co`)
+	f.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := s.Find(Query{ID: "1", Codec: "ALAC"})
+	if !ok || e.ISRC != "USAAA0000001" || !filepath.IsAbs(e.Path) || e.Time.IsZero() {
+		t.Errorf("Find(1, ALAC) = %+v, %v", e, ok)
+	}
+	if _, ok := s.Find(Query{ID: "1", Codec: "ATMOS"}); ok {
+		t.Error("Find matched an entry with a different codec")
+	}
+	if e, ok := s.Find(Query{ID: "99", ISRC: "USAAA0000002", Codec: "ATMOS"}); !ok || e.ID != "2" {
+		t.Errorf("Find by ISRC = %+v, %v", e, ok)
+	}
+	if _, ok := s.Find(Query{ID: "3"}); ok {
+		t.Error("torn line was loaded")
+	}
+	if e, ok := s.Find(Query{PreType: "albums", PreID: "b"}); ok {
+		t.Errorf("Find by source matched %+v", e)
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var s *Store
+	if err := s.Add(Entry{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Find(Query{ID: "1"}); ok {
+		t.Fatal("nil store returned an entry")
+	}
+}
@@ -0,0 +1,213 @@
+package lyrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ASS layers, from the bottom up.
+const (
+	assLeadLayer = iota
+	assBackgroundLayer
+	assTranslationLayer
+	assTransliterationLayer
+)
+
+const assHeader = `[Script Info]
+; Lyrics converted from Apple Music TTML
+ScriptType: v4.00+
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+PlayResX: 1920
+PlayResY: 1080
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+`
+
+const assEvents = `
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+// assStyle is a style line: the text is highlighted from the secondary to the primary colour
+// as the karaoke advances.
+type assStyle struct {
+	name      string
+	size      int
+	primary   string
+	alignment int // numpad position: 1 bottom left, 2 bottom centre, 3 bottom right, 8 top centre
+	marginV   int
+}
+
+func (s assStyle) String() string {
+	return fmt.Sprintf("Style: %s,Arial,%d,%s,&H00A0A0A0,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,3,0,%d,80,80,%d,1\n",
+		s.name, s.size, s.primary, s.alignment, s.marginV)
+}
+
+// ASS renders the time-synced lyrics as Advanced SubStation Alpha subtitles. Word-timed lines get a
+// {\k} karaoke tag per syllable. Every agent has its own style, lead singers of a duet on opposite
+// sides; background vocals, the translation and the transliteration go on layers of their own.
+// The agent marker goes before the lead vocals.
+func (d *Document) ASS(opts Options) (string, error) {
+	if d.Timing == "None" {
+		return "", errors.New("lyrics are not time-synced")
+	}
+	d = d.arranged(opts)
+	var b strings.Builder
+	b.WriteString(assHeader)
+	for _, s := range d.assStyles() {
+		b.WriteString(s.String())
+	}
+	b.WriteString(assEvents)
+	dialogue := func(layer int, begin, end time.Duration, style, name, text string) {
+		if text != "" {
+			fmt.Fprintf(&b, "Dialogue: %d,%s,%s,%s,%s,0,0,0,,%s\n", layer, assTime(begin), assTime(end), style, name, text)
+		}
+	}
+	for i := range d.Lines {
+		line := &d.Lines[i]
+		end := d.lineEnd(i)
+		style, name := d.agentStyle(line.Agent)
+		if lead := karaoke(line.Syllables, line.Begin, false); lead != "" {
+			dialogue(assLeadLayer, line.Begin, end, style, name, assEscape(d.marker(line, opts.AgentMarker))+lead)
+		}
+		bgBegin, bgEnd, ok := span(line.Syllables, true)
+		if !ok {
+			bgBegin, bgEnd = line.Begin, end
+		}
+		dialogue(assBackgroundLayer, bgBegin, bgEnd, "Background", name, karaoke(line.Syllables, bgBegin, true))
+		if s, ok := line.Localized(d.Translations); ok && opts.SubtitleTranslation {
+			dialogue(assTranslationLayer, line.Begin, end, "Translation", name, assEscape(spacedText(s)))
+		}
+		if s, ok := line.Localized(d.Transliterations); ok && opts.SubtitleTransliteration {
+			dialogue(assTransliterationLayer, line.Begin, end, "Transliteration", name, karaoke(asLead(s), line.Begin, false))
+		}
+	}
+	return b.String(), nil
+}
+
+// assStyles returns a style for every agent singing a line, then those of the other layers.
+func (d *Document) assStyles() []assStyle {
+	var styles []assStyle
+	used := map[string]bool{}
+	for _, line := range d.Lines {
+		if used[line.Agent] {
+			continue
+		}
+		used[line.Agent] = true
+		style, _ := d.agentStyle(line.Agent)
+		s := assStyle{name: style, size: 64, primary: "&H00FFFFFF", alignment: 2, marginV: 140}
+		switch d.agentRole(line.Agent) {
+		case "duet-1":
+			s.alignment = 1
+		case "duet-2":
+			s.alignment, s.primary = 3, "&H00FFD8A0"
+		case "group":
+			s.primary = "&H00A0F0FF"
+		}
+		styles = append(styles, s)
+	}
+	return append(styles,
+		assStyle{name: "Background", size: 48, primary: "&H00D0D0D0", alignment: 2, marginV: 220},
+		assStyle{name: "Translation", size: 44, primary: "&H00FFFFFF", alignment: 2, marginV: 70},
+		assStyle{name: "Transliteration", size: 44, primary: "&H00FFFFFF", alignment: 8, marginV: 70},
+	)
+}
+
+// agentStyle returns the style name and the display name of a line's agent.
+func (d *Document) agentStyle(agent string) (string, string) {
+	if agent == "" {
+		return "Default", ""
+	}
+	for _, a := range d.Agents {
+		if a.ID == agent {
+			return agent, a.Name
+		}
+	}
+	return agent, ""
+}
+
+// agentRole tells the first two singers of a duet and groups apart from a solo singer.
+func (d *Document) agentRole(agent string) string {
+	var people []string
+	for _, a := range d.Agents {
+		if a.ID == agent && a.Type == "group" {
+			return "group"
+		}
+		if a.Type == "person" {
+			people = append(people, a.ID)
+		}
+	}
+	if len(people) < 2 {
+		return ""
+	}
+	if agent == people[0] {
+		return "duet-1"
+	}
+	return "duet-2"
+}
+
+// span returns the time the lead or the background syllables of a line cover.
+func span(syllables []Syllable, background bool) (time.Duration, time.Duration, bool) {
+	var begin, end time.Duration
+	found := false
+	for _, s := range syllables {
+		if s.Background != background || !s.Timed {
+			continue
+		}
+		if !found {
+			begin = s.Begin
+		}
+		end, found = s.End, true
+	}
+	return begin, end, found
+}
+
+// asLead returns a copy of syllables with the background vocals turned into lead vocals.
+func asLead(syllables []Syllable) []Syllable {
+	lead := make([]Syllable, len(syllables))
+	for i, s := range syllables {
+		s.Background = false
+		lead[i] = s
+	}
+	return lead
+}
+
+// karaoke renders the lead or background syllables with a {\kN} tag before every timed one, N its
+// duration in centiseconds. Gaps become empty {\kN} tags so the highlight stays in sync with begin.
+func karaoke(syllables []Syllable, begin time.Duration, background bool) string {
+	var b strings.Builder
+	pos := centiseconds(begin)
+	for _, s := range syllables {
+		if s.Background != background {
+			continue
+		}
+		if !s.Timed {
+			b.WriteString(assEscape(s.Text))
+			continue
+		}
+		if gap := centiseconds(s.Begin) - pos; gap > 0 {
+			fmt.Fprintf(&b, "{\\k%d}", gap)
+		}
+		end := centiseconds(s.End)
+		fmt.Fprintf(&b, "{\\k%d}%s", max(end-centiseconds(s.Begin), 0), assEscape(s.Text))
+		pos = max(pos, end)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func centiseconds(d time.Duration) int64 {
+	return d.Milliseconds() / 10
+}
+
+// assTime formats d as h:mm:ss.cc.
+func assTime(d time.Duration) string {
+	cs := centiseconds(d)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// assEscape keeps lyrics from being read as override tags or line breaks.
+var assEscape = strings.NewReplacer("{", "(", "}", ")", "\\", "⧵", "\n", " ").Replace
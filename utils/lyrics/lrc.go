@@ -0,0 +1,220 @@
+package lyrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// lrcTime formats d as mm:ss.xx, minutes running past 59.
+func lrcTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d.%02d", ms/60000, ms/1000%60, ms%1000/10)
+}
+
+// LRC renders the document as LRC: plain lines for unsynced lyrics, line-synced LRC, or enhanced
+// LRC with <mm:ss.xx> word times for word-timed lyrics. By default a translation goes on its own
+// line before the original, and lines in CJK scripts are replaced by their transliteration;
+// opts.LRCLines and opts.LRCSeparator choose the parts and how they are laid out instead. Enhanced
+// LRC leaves the background vocals out unless opts.BackgroundVocals is "parentheses".
+func (d *Document) LRC(opts Options) string {
+	d = d.arranged(opts)
+	var lines []string
+	for i := range d.Lines {
+		line := &d.Lines[i]
+		marker := d.marker(line, opts.AgentMarker)
+		if len(opts.LRCLines) > 0 {
+			lines = append(lines, d.layoutLRC(line, marker, opts)...)
+			continue
+		}
+		switch d.Timing {
+		case "None":
+			if text := strings.TrimSpace(line.Text(true)); text != "" {
+				lines = append(lines, marker+text)
+			}
+		case "Word":
+			lines = append(lines, d.wordLRC(line, marker, opts.BackgroundVocals == "parentheses")...)
+		default:
+			lines = append(lines, d.lineLRC(line, marker)...)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d *Document) lineLRC(line *Line, marker string) []string {
+	var lines []string
+	stamp := "[" + lrcTime(line.Begin) + "]" + marker
+	text := line.Text(true)
+	if trans, ok := line.Localized(d.Translations); ok {
+		if t := joinText(trans, true); t != "" {
+			lines = append(lines, stamp+t)
+		}
+	}
+	if translit, ok := line.Localized(d.Transliterations); ok && containsCJK(text) {
+		if t := joinText(translit, true); t != "" {
+			return append(lines, stamp+t)
+		}
+	}
+	return append(lines, stamp+text)
+}
+
+func (d *Document) wordLRC(line *Line, marker string, background bool) []string {
+	words, begin, ok := enhancedLine(line, background)
+	if !ok {
+		return []string{words}
+	}
+	var lines []string
+	translit, stamp := "", "["+lrcTime(begin)+"]"+marker
+	if s, ok := line.Localized(d.Transliterations); ok {
+		if t, tBegin, ok := enhancedTransliteration(s); ok {
+			translit, stamp = t, "["+lrcTime(tBegin)+"]"+marker
+		}
+	}
+	if trans, ok := line.Localized(d.Translations); ok {
+		lines = append(lines, stamp+joinText(trans, background))
+	}
+	if translit != "" && containsCJK(line.Text(false)) {
+		return append(lines, stamp+translit)
+	}
+	return append(lines, "["+lrcTime(begin)+"]"+marker+words)
+}
+
+// lrcPart is the original, translation or transliteration of a line, rendered for LRC.
+type lrcPart struct {
+	begin time.Duration
+	text  string
+}
+
+// layoutLRC renders the opts.LRCLines parts of a line, each with a timestamp of its own or joined
+// by opts.LRCSeparator. A line that has none of them keeps the original, so no line goes missing.
+func (d *Document) layoutLRC(line *Line, marker string, opts Options) []string {
+	var parts []lrcPart
+	for _, kind := range opts.LRCLines {
+		if p, ok := d.lrcPart(line, kind, opts.BackgroundVocals == "parentheses"); ok {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		p, ok := d.lrcPart(line, "original", opts.BackgroundVocals == "parentheses")
+		if !ok {
+			return nil
+		}
+		parts = []lrcPart{p}
+	}
+	stamp := func(begin time.Duration) string {
+		if d.Timing == "None" {
+			return marker
+		}
+		return "[" + lrcTime(begin) + "]" + marker
+	}
+	if opts.LRCSeparator != "" {
+		texts := make([]string, len(parts))
+		for i, p := range parts {
+			texts[i] = p.text
+		}
+		return []string{stamp(parts[0].begin) + strings.Join(texts, opts.LRCSeparator)}
+	}
+	lines := make([]string, len(parts))
+	for i, p := range parts {
+		lines[i] = stamp(p.begin) + p.text
+	}
+	return lines
+}
+
+// lrcPart renders one part of a line: "original", "translation" or "transliteration". Word-timed
+// originals and transliterations keep their word times. It reports whether the line has the part;
+// the original of a synced line always counts, even when blank.
+func (d *Document) lrcPart(line *Line, kind string, background bool) (lrcPart, bool) {
+	switch kind {
+	case "original":
+		if d.Timing == "Word" {
+			words, begin, ok := enhancedLine(line, background)
+			return lrcPart{begin, words}, ok
+		}
+		text := line.Text(true)
+		if d.Timing == "None" {
+			text = strings.TrimSpace(text)
+			return lrcPart{text: text}, text != ""
+		}
+		return lrcPart{line.Begin, text}, true
+	case "translation":
+		if s, ok := line.Localized(d.Translations); ok {
+			text := strings.TrimSpace(joinText(s, background || d.Timing != "Word"))
+			return lrcPart{line.Begin, text}, text != ""
+		}
+	case "transliteration":
+		if s, ok := line.Localized(d.Transliterations); ok {
+			if d.Timing == "Word" {
+				if t, begin, ok := enhancedTransliteration(s); ok {
+					return lrcPart{begin, t}, true
+				}
+			}
+			text := strings.TrimSpace(joinText(s, background || d.Timing != "Word"))
+			return lrcPart{line.Begin, text}, text != ""
+		}
+	}
+	return lrcPart{}, false
+}
+
+// enhancedLine renders the vocals of a word-timed line, the background ones too if background is
+// set, as <mm:ss.xx>syllable<mm:ss.xx>syllable <mm:ss.xx>word<end>, keeping the spaces between words.
+// Without background an x-bg span with a time of its own still shows, as a single word.
+// It reports the begin time of the first syllable and whether there was one.
+func enhancedLine(line *Line, background bool) (string, time.Duration, bool) {
+	var b strings.Builder
+	var begin, end time.Duration
+	found := false
+	word := func(wordBegin, wordEnd time.Duration, text string) {
+		if !found {
+			begin, found = wordBegin, true
+		}
+		b.WriteString("<" + lrcTime(wordBegin) + ">" + text)
+		end = wordEnd
+	}
+	spans := line.BackgroundSpans
+	for i := 0; i < len(line.Syllables); i++ {
+		for len(spans) > 0 && spans[0].From < i {
+			spans = spans[1:]
+		}
+		s := &line.Syllables[i]
+		if s.Background && !background {
+			if len(spans) > 0 && spans[0].From == i {
+				word(spans[0].Begin, spans[0].End, joinText(line.Syllables[i:spans[0].To], true))
+				i, spans = spans[0].To-1, spans[1:]
+			}
+			continue
+		}
+		if !s.Timed {
+			if found && strings.TrimSpace(s.Text) == "" {
+				b.WriteString(" ")
+			}
+			continue
+		}
+		word(s.Begin, s.End, s.Text)
+	}
+	if !found {
+		return "", 0, false
+	}
+	b.WriteString("<" + lrcTime(end) + ">")
+	return b.String(), begin, true
+}
+
+// enhancedTransliteration renders a timed transliteration as <mm:ss.xx>syllable <mm:ss.xx>syllable,
+// one space between all syllables and no end time.
+func enhancedTransliteration(syllables []Syllable) (string, time.Duration, bool) {
+	var parts []string
+	var begin time.Duration
+	for _, s := range syllables {
+		if s.Background || !s.Timed {
+			continue
+		}
+		if parts == nil {
+			begin = s.Begin
+		}
+		parts = append(parts, "<"+lrcTime(s.Begin)+">"+s.Text)
+	}
+	if parts == nil {
+		return "", 0, false
+	}
+	return strings.Join(parts, " "), begin, true
+}
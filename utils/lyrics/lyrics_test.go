@@ -0,0 +1,199 @@
+package lyrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The .lrc goldens were written by the converter that predates Document, so LRC output must
+// keep matching them byte for byte.
+func TestLRCGolden(t *testing.T) {
+	for _, name := range []string{"line", "line_plain", "word", "word_bg", "word_plain", "none"} {
+		t.Run(name, func(t *testing.T) {
+			ttml, err := os.ReadFile(filepath.Join("testdata", name+".ttml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", name+".lrc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := TtmlToLrc(string(ttml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestConvertGolden(t *testing.T) {
+	for _, tt := range []struct {
+		ttml, golden, format string
+		opts                 Options
+	}{
+		{"line.ttml", "line.srt", "srt", Options{SubtitleTranslation: true, SubtitleTransliteration: true}},
+		{"word.ttml", "word.vtt", "vtt", Options{}},
+		{"word.ttml", "word.ass", "ass", Options{SubtitleTranslation: true, SubtitleTransliteration: true}},
+		{"line.ttml", "line.ass", "ass", Options{SubtitleTranslation: true}},
+		{"word.ttml", "word_agents.lrc", "lrc", Options{AgentMarker: "{agent}: ", BackgroundVocals: "parentheses"}},
+		{"line.ttml", "line_strip.srt", "srt", Options{AgentMarker: "[{name}] ", BackgroundVocals: "strip", SubtitleTranslation: true}},
+		{"word.ttml", "word_agents.vtt", "vtt", Options{AgentMarker: "{name}", BackgroundVocals: "parentheses"}},
+		{"word.ttml", "word_layout.lrc", "lrc", Options{LRCLines: []string{"original", "transliteration", "translation"}}},
+		{"line.ttml", "line_layout.lrc", "lrc", Options{LRCLines: []string{"original", "translation"}, LRCSeparator: " / "}},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			ttml, err := os.ReadFile(filepath.Join("testdata", tt.ttml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Convert(string(ttml), tt.format, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSubtitleCueEnds(t *testing.T) {
+	doc, err := Parse(`<tt xmlns="http://www.w3.org/ns/ttml"><body><div><p begin="1.000">One &amp; <span>two</span></p><p begin="3.500">Three</p></div></body></tt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := doc.VTT(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:03.500\nOne &amp; two\n\n00:00:03.500 --> 00:00:08.500\nThree\n\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := Convert(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:itunes="http://music.apple.com/lyric-ttml-internal" itunes:timing="None"><body><div><p>One</p></div></body></tt>`, "srt", Options{}); err == nil {
+		t.Error("unsynced lyrics were converted to SRT")
+	}
+}
+
+func TestBackground(t *testing.T) {
+	line := []Syllable{{Text: "Stay "}, {Text: "with me", Timed: true}, {Text: "stay ", Background: true}, {Text: "now", Timed: true, Background: true}}
+	if got := joinText(background(line, "parentheses"), true); got != "Stay with me (stay now)" {
+		t.Errorf("parentheses = %q", got)
+	}
+	if got := joinText(background(line, "strip"), true); got != "Stay with me" {
+		t.Errorf("strip = %q", got)
+	}
+	trailing := []Syllable{{Text: "world", Timed: true}, {Text: " "}, {Text: "(hey)", Timed: true, Background: true}}
+	if got := background(trailing, "strip"); len(got) != 1 {
+		t.Errorf("strip left %+v", got)
+	}
+}
+
+func TestMarker(t *testing.T) {
+	doc := &Document{Agents: []Agent{{ID: "v1", Type: "person", Name: "Singer A"}}, Lines: []Line{{Agent: "v1"}, {Agent: "v1000"}}}
+	if got := doc.marker(&doc.Lines[0], "{agent} {name}: "); got != "v1 Singer A: " {
+		t.Errorf("marker = %q", got)
+	}
+	if got := doc.marker(&doc.Lines[1], "{name}: "); got != "v1000: " {
+		t.Errorf("unnamed marker = %q", got)
+	}
+	doc.Lines = doc.Lines[:1]
+	if got := doc.marker(&doc.Lines[0], "{agent}: "); got != "" {
+		t.Errorf("solo marker = %q", got)
+	}
+}
+
+func TestTranslationLanguage(t *testing.T) {
+	ttml := `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:itunes="http://music.apple.com/lyric-ttml-internal" itunes:timing="Line" xml:lang="ja"><head><metadata><iTunesMetadata xmlns="http://music.apple.com/lyric-ttml-internal"><translations>` +
+		`<translation xml:lang="en"><text for="L1">Hello</text></translation>` +
+		`<translation xml:lang="zh-Hans"><text for="L1">你好</text></translation>` +
+		`<translation xml:lang="zh-Hant"><text for="L1">妳好</text></translation>` +
+		`</translations></iTunesMetadata></metadata></head><body><div><p begin="1.000" itunes:key="L1">こんにちは</p></div></body></tt>`
+	for language, want := range map[string]string{
+		"":        "[00:01.00]Hello",
+		"zh-Hant": "[00:01.00]妳好",
+		"zh":      "[00:01.00]你好",
+		"ZH-HANT": "[00:01.00]妳好",
+		"ko":      "[00:01.00]Hello",
+	} {
+		got, err := Convert(ttml, "lrc", Options{TranslationLanguage: language, LRCLines: []string{"translation"}})
+		if err != nil || got != want {
+			t.Errorf("translation-language %q = %q, %v", language, got, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	ttml, err := os.ReadFile(filepath.Join("testdata", "word.ttml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Parse(string(ttml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Timing != "Word" || doc.Language != "ja" || len(doc.Lines) != 3 {
+		t.Fatalf("timing %q, language %q, %d lines", doc.Timing, doc.Language, len(doc.Lines))
+	}
+	if len(doc.Agents) != 2 || doc.Agents[1] != (Agent{ID: "v2", Type: "person", Name: "Singer B"}) {
+		t.Errorf("agents = %+v", doc.Agents)
+	}
+	line := doc.Lines[1]
+	if line.Key != "L2" || line.Agent != "v2" || line.Begin != 3*time.Second || line.End != 5*time.Second {
+		t.Errorf("line = %+v", line)
+	}
+	if got := line.Text(false); got != "Hello world" {
+		t.Errorf("lead text = %q", got)
+	}
+	if got := line.Text(true); got != "Hello world(hey hey)" {
+		t.Errorf("text = %q", got)
+	}
+	last := line.Syllables[len(line.Syllables)-1]
+	if !last.Background || !last.Timed || last.Begin != 4700*time.Millisecond || last.Text != "hey)" {
+		t.Errorf("last syllable = %+v", last)
+	}
+	if len(doc.Translations) != 1 || doc.Translations[0].Language != "en" {
+		t.Fatalf("translations = %+v", doc.Translations)
+	}
+	if got := joinText(doc.Translations[0].Lines["L3"], true); got != "Running to you" {
+		t.Errorf("L3 translation = %q", got)
+	}
+	translit := doc.Transliterations[0].Lines["L3"]
+	if doc.Transliterations[0].Language != "ja-Latn" || len(translit) != 4 || translit[0].Begin != 62100*time.Millisecond {
+		t.Errorf("L3 transliteration = %+v", translit)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"12.345":      12345 * time.Millisecond,
+		"0.5":         500 * time.Millisecond,
+		"1:02.345":    62345 * time.Millisecond,
+		"1:02":        62 * time.Second,
+		"1:01:06.000": 3666 * time.Second,
+	} {
+		if got, err := parseTime(value); err != nil || got != want {
+			t.Errorf("parseTime(%q) = %v, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"", "1:2:3:4", "a.5", "1.x"} {
+		if _, err := parseTime(value); err == nil {
+			t.Errorf("parseTime(%q) accepted", value)
+		}
+	}
+}
+
+func TestParseUnsynced(t *testing.T) {
+	if _, err := Parse(`<tt xmlns="http://www.w3.org/ns/ttml"><body><div><p>No time</p></div></body></tt>`); err == nil {
+		t.Error("line-timed lyrics without begin times were accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package lyrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// lastCue is how long the final line stays on screen when the TTML gives it no end time.
+const lastCue = 5 * time.Second
+
+// cue is one subtitle: a line of the lyrics and the extra lines shown with it.
+type cue struct {
+	begin, end time.Duration
+	marker     string // Options.AgentMarker of the line
+	voice      string // singer of a marked line
+	lines      []string
+}
+
+// cues turns the synced lines of the document into subtitle cues.
+func (d *Document) cues(opts Options) ([]cue, error) {
+	if d.Timing == "None" {
+		return nil, errors.New("lyrics are not time-synced")
+	}
+	d = d.arranged(opts)
+	var cues []cue
+	for i := range d.Lines {
+		line := &d.Lines[i]
+		text := spacedText(line.Syllables)
+		if text == "" {
+			continue
+		}
+		c := cue{begin: line.Begin, end: d.lineEnd(i), marker: d.marker(line, opts.AgentMarker), lines: []string{text}}
+		if c.marker != "" {
+			c.voice = d.singer(line.Agent)
+		}
+		if opts.SubtitleTranslation {
+			if s, ok := line.Localized(d.Translations); ok {
+				if t := spacedText(s); t != "" {
+					c.lines = append(c.lines, t)
+				}
+			}
+		}
+		if opts.SubtitleTransliteration {
+			if s, ok := line.Localized(d.Transliterations); ok {
+				if t := spacedText(s); t != "" {
+					c.lines = append(c.lines, t)
+				}
+			}
+		}
+		cues = append(cues, c)
+	}
+	return cues, nil
+}
+
+// lineEnd returns when line i ends: at its TTML end time, or else when the next line begins.
+func (d *Document) lineEnd(i int) time.Duration {
+	line := &d.Lines[i]
+	if line.End > line.Begin {
+		return line.End
+	}
+	if i+1 < len(d.Lines) && d.Lines[i+1].Begin > line.Begin {
+		return d.Lines[i+1].Begin
+	}
+	return line.Begin + lastCue
+}
+
+// spacedText joins the syllables like joinText, but makes sure lead and background vocals are
+// separated by a space.
+func spacedText(syllables []Syllable) string {
+	var b strings.Builder
+	for i, s := range syllables {
+		if i > 0 && s.Background != syllables[i-1].Background && b.Len() > 0 &&
+			!strings.HasSuffix(b.String(), " ") && !strings.HasPrefix(s.Text, " ") {
+			b.WriteString(" ")
+		}
+		b.WriteString(s.Text)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// subtitleTime formats d as hh:mm:ss followed by sep and milliseconds.
+func subtitleTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// SRT renders the time-synced lyrics as SubRip subtitles, the agent marker before the lyrics of a cue.
+func (d *Document) SRT(opts Options) (string, error) {
+	cues, err := d.cues(opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, c := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s%s\n\n", i+1, subtitleTime(c.begin, ","), subtitleTime(c.end, ","), c.marker, strings.Join(c.lines, "\n"))
+	}
+	return b.String(), nil
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// VTT renders the time-synced lyrics as WebVTT subtitles. Marked cues name their singer in a
+// <v> voice span instead of the marker.
+func (d *Document) VTT(opts Options) (string, error) {
+	cues, err := d.cues(opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		voice := ""
+		if c.voice != "" {
+			voice = "<v " + vttEscaper.Replace(c.voice) + ">"
+		}
+		fmt.Fprintf(&b, "%s --> %s\n%s%s\n\n", subtitleTime(c.begin, "."), subtitleTime(c.end, "."), voice, vttEscaper.Replace(strings.Join(c.lines, "\n")))
+	}
+	return b.String(), nil
+}
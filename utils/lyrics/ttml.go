@@ -0,0 +1,417 @@
+package lyrics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Document is a parsed Apple Music TTML lyrics file.
+type Document struct {
+	Timing           string // "None", "Line" or "Word" (itunes:timing)
+	Language         string
+	Agents           []Agent
+	Lines            []Line
+	Translations     []Localization
+	Transliterations []Localization
+}
+
+// Agent is a voice declared in the head, referenced by the ttm:agent of lines.
+type Agent struct {
+	ID   string // e.g. "v1", "v2", "v1000"
+	Type string // "person", "group" or "other"
+	Name string
+}
+
+// Line is one p element of the body.
+type Line struct {
+	Key        string // itunes:key, links the line to its translations and transliterations
+	Agent      string
+	Begin, End time.Duration
+	Syllables  []Syllable
+	// BackgroundSpans are the x-bg spans of the line that have a begin and end of their own.
+	BackgroundSpans []BackgroundSpan
+}
+
+// BackgroundSpan is a timed x-bg span: the background vocals Syllables[From:To] of its line,
+// sung from Begin to End.
+type BackgroundSpan struct {
+	Begin, End time.Duration
+	From, To   int
+}
+
+// Syllable is a run of text in a line. Word-timed lines consist of timed syllables separated by
+// untimed whitespace; line-timed lines usually hold a single untimed run.
+type Syllable struct {
+	Text       string
+	Begin, End time.Duration
+	Timed      bool
+	Background bool // inside a ttm:role="x-bg" span
+}
+
+// Localization is a translation or transliteration of the lines, keyed by itunes:key.
+type Localization struct {
+	Language string
+	Lines    map[string][]Syllable
+}
+
+// Text returns the text of the line, with or without the background vocals.
+func (l *Line) Text(background bool) string {
+	return joinText(l.Syllables, background)
+}
+
+// Localized returns the text the first localization of locs gives the line, and whether it has one.
+func (l *Line) Localized(locs []Localization) ([]Syllable, bool) {
+	if len(locs) == 0 {
+		return nil, false
+	}
+	s, ok := locs[0].Lines[l.Key]
+	return s, ok
+}
+
+// singer returns the name of an agent, or the agent itself when the TTML does not name it.
+func (d *Document) singer(agent string) string {
+	for _, a := range d.Agents {
+		if a.ID == agent && a.Name != "" {
+			return a.Name
+		}
+	}
+	return agent
+}
+
+// marker returns the Options.AgentMarker of a line, or "" when a single agent sings the whole song.
+func (d *Document) marker(line *Line, format string) string {
+	if format == "" || line.Agent == "" {
+		return ""
+	}
+	for _, l := range d.Lines {
+		if l.Agent != "" && l.Agent != line.Agent {
+			return strings.NewReplacer("{agent}", line.Agent, "{name}", d.singer(line.Agent)).Replace(format)
+		}
+	}
+	return ""
+}
+
+// arranged returns the document as opts want it rendered: with the translation in
+// opts.TranslationLanguage first and the background vocals handled, see Options.
+func (d *Document) arranged(opts Options) *Document {
+	d = d.withBackground(opts.BackgroundVocals)
+	if i := localization(d.Translations, opts.TranslationLanguage); i > 0 {
+		c := *d
+		c.Translations = append([]Localization{d.Translations[i]}, append(d.Translations[:i:i], d.Translations[i+1:]...)...)
+		return &c
+	}
+	return d
+}
+
+// localization returns the index of the localization in language, or else the first one in the
+// same base language ("zh" for "zh-Hant"), or -1.
+func localization(locs []Localization, language string) int {
+	if language == "" {
+		return -1
+	}
+	base, _, _ := strings.Cut(language, "-")
+	match := -1
+	for i, loc := range locs {
+		if strings.EqualFold(loc.Language, language) {
+			return i
+		}
+		if b, _, _ := strings.Cut(loc.Language, "-"); match < 0 && strings.EqualFold(b, base) {
+			match = i
+		}
+	}
+	return match
+}
+
+// withBackground returns the document with the background vocals of its lines and localizations
+// put in parentheses or left out, see Options.BackgroundVocals.
+func (d *Document) withBackground(mode string) *Document {
+	if mode != "parentheses" && mode != "strip" {
+		return d
+	}
+	c := *d
+	c.Lines = make([]Line, len(d.Lines))
+	for i, line := range d.Lines {
+		line.Syllables = background(line.Syllables, mode)
+		line.BackgroundSpans = nil // they index the old syllables, and only matter without a mode
+		c.Lines[i] = line
+	}
+	c.Translations = localizedBackground(d.Translations, mode)
+	c.Transliterations = localizedBackground(d.Transliterations, mode)
+	return &c
+}
+
+func localizedBackground(locs []Localization, mode string) []Localization {
+	out := make([]Localization, len(locs))
+	for i, loc := range locs {
+		out[i] = Localization{Language: loc.Language, Lines: make(map[string][]Syllable, len(loc.Lines))}
+		for key, syllables := range loc.Lines {
+			out[i].Lines[key] = background(syllables, mode)
+		}
+	}
+	return out
+}
+
+// background puts every run of background syllables in parentheses, unless the TTML already has
+// them, with a space before it; or with mode "strip" drops them and the space they leave.
+func background(syllables []Syllable, mode string) []Syllable {
+	var out []Syllable
+	for i := 0; i < len(syllables); {
+		if !syllables[i].Background {
+			out = append(out, syllables[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(syllables) && syllables[j].Background {
+			j++
+		}
+		if mode == "parentheses" {
+			if len(out) > 0 && !strings.HasSuffix(out[len(out)-1].Text, " ") {
+				out = append(out, Syllable{Text: " ", Background: true})
+			}
+			out = append(out, parenthesized(syllables[i:j])...)
+		}
+		i = j
+	}
+	if mode == "strip" && len(out) > 0 {
+		out[0].Text = strings.TrimLeft(out[0].Text, " ")
+		out[len(out)-1].Text = strings.TrimRight(out[len(out)-1].Text, " ")
+		out = slices.DeleteFunc(out, func(s Syllable) bool { return s.Text == "" && !s.Timed })
+	}
+	return out
+}
+
+func parenthesized(group []Syllable) []Syllable {
+	group = append([]Syllable(nil), group...)
+	first, last := -1, -1
+	for k, s := range group {
+		if strings.TrimSpace(s.Text) != "" {
+			if first < 0 {
+				first = k
+			}
+			last = k
+		}
+	}
+	if first < 0 {
+		return group
+	}
+	if text := strings.TrimSpace(joinText(group, true)); strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		return group
+	}
+	group[first].Text = "(" + strings.TrimLeft(group[first].Text, " ")
+	group[last].Text = strings.TrimRight(group[last].Text, " ") + ")"
+	return group
+}
+
+func joinText(syllables []Syllable, background bool) string {
+	var b strings.Builder
+	for _, s := range syllables {
+		if background || !s.Background {
+			b.WriteString(s.Text)
+		}
+	}
+	return b.String()
+}
+
+// Parse reads a TTML lyrics document. Line-timed documents must have a begin time on every line.
+func Parse(ttml string) (*Document, error) {
+	parsed := etree.NewDocument()
+	if err := parsed.ReadFromString(ttml); err != nil {
+		return nil, err
+	}
+	tt := parsed.FindElement("tt")
+	if tt == nil {
+		return nil, errors.New("not a TTML document")
+	}
+	d := &Document{
+		Timing:   tt.SelectAttrValue("itunes:timing", "Line"),
+		Language: tt.SelectAttrValue("xml:lang", ""),
+	}
+	if metadata := tt.FindElement("head/metadata"); metadata != nil {
+		for _, e := range metadata.ChildElements() {
+			if e.Tag != "agent" {
+				continue
+			}
+			agent := Agent{ID: e.SelectAttrValue("xml:id", ""), Type: e.SelectAttrValue("type", "")}
+			if name := e.FindElement("name"); name != nil {
+				agent.Name = name.Text()
+			}
+			d.Agents = append(d.Agents, agent)
+		}
+		if itunes := metadata.FindElement("iTunesMetadata"); itunes != nil {
+			var err error
+			if d.Translations, err = localizations(itunes.FindElements("translations/translation")); err != nil {
+				return nil, err
+			}
+			if d.Transliterations, err = localizations(itunes.FindElements("transliterations/transliteration")); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if d.Timing == "None" {
+		for _, p := range tt.FindElements("//p") {
+			syllables, err := runs(p, false)
+			if err != nil {
+				return nil, err
+			}
+			d.Lines = append(d.Lines, Line{Key: p.SelectAttrValue("itunes:key", ""), Agent: p.SelectAttrValue("ttm:agent", ""), Syllables: syllables})
+		}
+		return d, nil
+	}
+	body := tt.FindElement("body")
+	if body == nil {
+		return d, nil
+	}
+	for _, div := range body.ChildElements() {
+		for _, p := range div.ChildElements() {
+			line := Line{Key: p.SelectAttrValue("itunes:key", ""), Agent: p.SelectAttrValue("ttm:agent", "")}
+			var err error
+			if begin := p.SelectAttr("begin"); begin != nil {
+				if line.Begin, err = parseTime(begin.Value); err != nil {
+					return nil, err
+				}
+			} else if d.Timing != "Word" {
+				return nil, errors.New("no synchronised lyrics")
+			}
+			if end := p.SelectAttr("end"); end != nil {
+				if line.End, err = parseTime(end.Value); err != nil {
+					return nil, err
+				}
+			}
+			if line.Syllables, line.BackgroundSpans, err = lineRuns(p, false); err != nil {
+				return nil, err
+			}
+			if p.SelectAttr("begin") == nil {
+				for _, s := range line.Syllables {
+					if s.Timed {
+						line.Begin = s.Begin
+						break
+					}
+				}
+			}
+			d.Lines = append(d.Lines, line)
+		}
+	}
+	return d, nil
+}
+
+func localizations(elements []*etree.Element) ([]Localization, error) {
+	var locs []Localization
+	for _, e := range elements {
+		loc := Localization{Language: e.SelectAttrValue("xml:lang", ""), Lines: map[string][]Syllable{}}
+		for _, t := range e.SelectElements("text") {
+			syllables, err := runs(t, false)
+			if err != nil {
+				return nil, err
+			}
+			loc.Lines[t.SelectAttrValue("for", "")] = syllables
+		}
+		locs = append(locs, loc)
+	}
+	return locs, nil
+}
+
+// runs splits the content of a p or text element into syllables. A text attribute stands for
+// the whole content; x-bg spans contribute their children as background syllables.
+func runs(e *etree.Element, background bool) ([]Syllable, error) {
+	syllables, _, err := lineRuns(e, background)
+	return syllables, err
+}
+
+// lineRuns is runs that also returns the timing of the x-bg spans which carry one.
+func lineRuns(e *etree.Element, background bool) ([]Syllable, []BackgroundSpan, error) {
+	if attr := e.SelectAttr("text"); attr != nil {
+		return []Syllable{{Text: attr.Value, Background: background}}, nil, nil
+	}
+	var syllables []Syllable
+	var spans []BackgroundSpan
+	for _, token := range e.Child {
+		switch c := token.(type) {
+		case *etree.CharData:
+			syllables = append(syllables, Syllable{Text: c.Data, Background: background})
+		case *etree.Element:
+			begin, end, timed, err := spanTime(c)
+			if err != nil {
+				return nil, nil, err
+			}
+			if c.SelectAttrValue("ttm:role", "") == "x-bg" {
+				bg, err := runs(c, true)
+				if err != nil {
+					return nil, nil, err
+				}
+				if timed {
+					spans = append(spans, BackgroundSpan{Begin: begin, End: end, From: len(syllables), To: len(syllables) + len(bg)})
+				}
+				syllables = append(syllables, bg...)
+				continue
+			}
+			syllables = append(syllables, Syllable{Text: innerText(c), Begin: begin, End: end, Timed: timed, Background: background})
+		}
+	}
+	return syllables, spans, nil
+}
+
+// spanTime reads the begin and end of an element, end defaulting to begin, and reports whether it
+// has them.
+func spanTime(e *etree.Element) (time.Duration, time.Duration, bool, error) {
+	begin := e.SelectAttr("begin")
+	if begin == nil {
+		return 0, 0, false, nil
+	}
+	b, err := parseTime(begin.Value)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	end, err := parseTime(e.SelectAttrValue("end", begin.Value))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return b, end, true, nil
+}
+
+func innerText(e *etree.Element) string {
+	var b strings.Builder
+	for _, token := range e.Child {
+		switch c := token.(type) {
+		case *etree.CharData:
+			b.WriteString(c.Data)
+		case *etree.Element:
+			b.WriteString(innerText(c))
+		}
+	}
+	return b.String()
+}
+
+// parseTime reads a TTML clock value: "h:mm:ss.fff", "m:ss.fff", "m:ss" or "s.fff".
+func parseTime(value string) (time.Duration, error) {
+	clock, fraction, _ := strings.Cut(value, ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	var seconds int
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	var ms int
+	if fraction != "" {
+		fraction = (fraction + "00")[:3]
+		n, err := strconv.Atoi(fraction)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		ms = n
+	}
+	return time.Duration(seconds)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
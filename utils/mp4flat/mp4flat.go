@@ -0,0 +1,169 @@
+// Package mp4flat turns the fragmented MP4 written by the decrypters (an init segment followed
+// by moof/mdat pairs) into a progressive file with one mdat, which taggers and most players expect.
+package mp4flat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/itouakirai/mp4ff/mp4"
+)
+
+// Flatten rewrites the fragmented single-track MP4 at path as a progressive one, in place.
+// Files that are not fragmented are left alone.
+func Flatten(path string) error {
+	f, err := mp4.ReadMP4File(path)
+	if err != nil {
+		return err
+	}
+	if !f.IsFragmented() {
+		return nil
+	}
+	if f.Init == nil || len(f.Init.Moov.Traks) != 1 {
+		return errors.New("expected a fragmented file with exactly one track")
+	}
+	moov := f.Init.Moov
+	trak := moov.Trak
+	var trex *mp4.TrexBox
+	if moov.Mvex != nil {
+		trex, _ = moov.Mvex.GetTrex(trak.Tkhd.TrackID)
+	}
+
+	// one chunk per fragment keeps the interleaving of the source
+	var chunks [][]mp4.FullSample
+	for _, seg := range f.Segments {
+		for _, frag := range seg.Fragments {
+			samples, err := frag.GetFullSamples(trex)
+			if err != nil {
+				return err
+			}
+			if len(samples) > 0 {
+				chunks = append(chunks, samples)
+			}
+		}
+	}
+
+	stbl, mdatSize, duration := sampleTables(trak.Mdia.Minf.Stbl.Stsd, chunks)
+	replaceChild(trak.Mdia.Minf.Children, stbl)
+	trak.Mdia.Minf.Stbl = stbl
+	trak.Mdia.Mdhd.Duration = duration
+	moviesDuration := duration * uint64(moov.Mvhd.Timescale) / uint64(trak.Mdia.Mdhd.Timescale)
+	moov.Mvhd.Duration = moviesDuration
+	trak.Tkhd.Duration = moviesDuration
+	removeChild(moov, "mvex")
+	moov.Mvex = nil
+
+	ftyp := mp4.NewFtyp("M4A ", 0, []string{"M4A ", "mp42", "isom"})
+	if trak.Mdia.Hdlr != nil && trak.Mdia.Hdlr.HandlerType != "soun" {
+		ftyp = mp4.NewFtyp("mp42", 0, []string{"mp42", "isom"})
+	}
+	offset := ftyp.Size() + moov.Size() + 8
+	if offset+mdatSize > math.MaxUint32 {
+		return fmt.Errorf("%d bytes of media data do not fit 32-bit chunk offsets", mdatSize)
+	}
+	for i, samples := range chunks {
+		stbl.Stco.ChunkOffset[i] = uint32(offset)
+		for _, s := range samples {
+			offset += uint64(len(s.Data))
+		}
+	}
+	return write(path, ftyp, moov, chunks, mdatSize)
+}
+
+// sampleTables builds an stbl for the samples of chunks around the original sample description.
+// The chunk offsets are left zero since they depend on the final size of the moov box.
+func sampleTables(stsd *mp4.StsdBox, chunks [][]mp4.FullSample) (*mp4.StblBox, uint64, uint64) {
+	stts := &mp4.SttsBox{}
+	stsc := &mp4.StscBox{}
+	stsz := &mp4.StszBox{}
+	var size, duration uint64
+	for i, samples := range chunks {
+		if i == 0 || stsc.Entries[len(stsc.Entries)-1].SamplesPerChunk != uint32(len(samples)) {
+			stsc.AddEntry(uint32(i+1), uint32(len(samples)), 1)
+		}
+		for _, s := range samples {
+			if n := len(stts.SampleCount); n > 0 && stts.SampleTimeDelta[n-1] == s.Dur {
+				stts.SampleCount[n-1]++
+			} else {
+				stts.SampleCount = append(stts.SampleCount, 1)
+				stts.SampleTimeDelta = append(stts.SampleTimeDelta, s.Dur)
+			}
+			stsz.SampleSize = append(stsz.SampleSize, uint32(len(s.Data)))
+			size += uint64(len(s.Data))
+			duration += uint64(s.Dur)
+		}
+	}
+	stsz.SampleNumber = uint32(len(stsz.SampleSize))
+	stbl := mp4.NewStblBox()
+	stbl.AddChild(stsd)
+	stbl.AddChild(stts)
+	stbl.AddChild(stsc)
+	stbl.AddChild(stsz)
+	stbl.AddChild(&mp4.StcoBox{ChunkOffset: make([]uint32, len(chunks))})
+	return stbl, size, duration
+}
+
+func replaceChild(children []mp4.Box, box mp4.Box) {
+	for i, c := range children {
+		if c.Type() == box.Type() {
+			children[i] = box
+		}
+	}
+}
+
+func removeChild(moov *mp4.MoovBox, typ string) {
+	kept := moov.Children[:0]
+	for _, c := range moov.Children {
+		if c.Type() != typ {
+			kept = append(kept, c)
+		}
+	}
+	moov.Children = kept
+}
+
+// write stores the flattened file next to path and renames it over the original.
+func write(path string, ftyp *mp4.FtypBox, moov *mp4.MoovBox, chunks [][]mp4.FullSample, mdatSize uint64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".flatten-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	w := bufio.NewWriter(tmp)
+	if err := ftyp.Encode(w); err != nil {
+		return err
+	}
+	if err := moov.Encode(w); err != nil {
+		return err
+	}
+	hdr := binary.BigEndian.AppendUint32(nil, uint32(mdatSize+8))
+	if _, err := w.Write(append(hdr, "mdat"...)); err != nil {
+		return err
+	}
+	for _, samples := range chunks {
+		for _, s := range samples {
+			if _, err := w.Write(s.Data); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,100 @@
+package mp4flat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itouakirai/mp4ff/aac"
+	"github.com/itouakirai/mp4ff/mp4"
+)
+
+// writeFragmented writes an AAC track of three fragments with 2, 2 and 1 samples.
+func writeFragmented(t *testing.T) (string, [][]byte) {
+	t.Helper()
+	init := mp4.CreateEmptyInit()
+	init.AddEmptyTrack(44100, "audio", "und")
+	if err := init.Moov.Trak.SetAACDescriptor(aac.AAClc, 44100); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := init.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var all [][]byte
+	var decodeTime uint64
+	for i, n := range []int{2, 2, 1} {
+		frag, err := mp4.CreateFragment(uint32(i+1), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < n; j++ {
+			data := bytes.Repeat([]byte{byte(len(all) + 1)}, 10+len(all))
+			frag.AddFullSample(mp4.FullSample{
+				Sample:     mp4.Sample{Flags: mp4.SyncSampleFlags, Dur: 1024, Size: uint32(len(data))},
+				DecodeTime: decodeTime,
+				Data:       data,
+			})
+			decodeTime += 1024
+			all = append(all, data)
+		}
+		if err := frag.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "track.m4a")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, all
+}
+
+func TestFlatten(t *testing.T) {
+	path, samples := writeFragmented(t)
+	if err := Flatten(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mp4.ReadMP4File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.IsFragmented() || f.Moov.Mvex != nil {
+		t.Fatal("file is still fragmented")
+	}
+	if f.Ftyp.MajorBrand() != "M4A " {
+		t.Errorf("major brand = %q", f.Ftyp.MajorBrand())
+	}
+	trak := f.Moov.Trak
+	if d := trak.Mdia.Mdhd.Duration; d != 5*1024 {
+		t.Errorf("mdhd duration = %d", d)
+	}
+	stbl := trak.Mdia.Minf.Stbl
+	if n := stbl.Stsz.GetNrSamples(); n != uint32(len(samples)) {
+		t.Fatalf("%d samples, want %d", n, len(samples))
+	}
+	if len(stbl.Stco.ChunkOffset) != 3 || len(stbl.Stsc.Entries) != 2 {
+		t.Errorf("stco = %v, stsc = %v", stbl.Stco.ChunkOffset, stbl.Stsc.Entries)
+	}
+	var got bytes.Buffer
+	if err := f.CopySampleData(&got, nil, trak, 1, uint32(len(samples)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(samples, nil); !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("sample data = %v, want %v", got.Bytes(), want)
+	}
+}
+
+func TestFlattenProgressive(t *testing.T) {
+	path, _ := writeFragmented(t)
+	if err := Flatten(path); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+	if err := Flatten(path); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("a progressive file was rewritten")
+	}
+}
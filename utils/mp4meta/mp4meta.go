@@ -0,0 +1,486 @@
+// Package mp4meta writes iTunes metadata items that go-mp4tag does not know about,
+// such as cpil or the classical work and movement atoms.
+//
+// Only the moov box is rewritten; chunk offsets are shifted when the media data follows it.
+package mp4meta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Data types of the data box of an ilst item.
+const (
+	TypeImplicit = 0
+	TypeUTF8     = 1
+	TypeJPEG     = 13
+	TypePNG      = 14
+	TypeInteger  = 21
+)
+
+// Item is one ilst item with one data box per value. An item without values is removed.
+type Item struct {
+	Name   string // four characters, e.g. "cpil" or "©wrk"
+	Type   uint32
+	Values [][]byte
+}
+
+// Text returns a UTF-8 item, or a removal when s is empty.
+func Text(name string, s string) Item {
+	return TextList(name, []string{s})
+}
+
+// TextList returns a UTF-8 item holding every non-empty string of list, e.g. several genres.
+func TextList(name string, list []string) Item {
+	item := Item{Name: name, Type: TypeUTF8}
+	for _, s := range list {
+		if s != "" {
+			item.Values = append(item.Values, []byte(s))
+		}
+	}
+	return item
+}
+
+// Flag returns a one-byte boolean item such as cpil, pgap or shwm, or a removal when b is false.
+func Flag(name string, b bool) Item {
+	if !b {
+		return Item{Name: name}
+	}
+	return Item{Name: name, Type: TypeInteger, Values: [][]byte{{1}}}
+}
+
+// Int returns a big-endian integer item of size 1, 2, 4 or 8 bytes, or a removal when n is 0.
+func Int(name string, n int64, size int) Item {
+	if n == 0 {
+		return Item{Name: name}
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return Item{Name: name, Type: TypeInteger, Values: [][]byte{b[8-size:]}}
+}
+
+// atomName converts a name to its four bytes, mapping '©' to the Mac Roman 0xA9 used by iTunes.
+func atomName(name string) (string, error) {
+	var b []byte
+	for _, r := range name {
+		switch {
+		case r == '©':
+			b = append(b, 0xA9)
+		case r < 0x80:
+			b = append(b, byte(r))
+		default:
+			return "", fmt.Errorf("invalid atom name %q", name)
+		}
+	}
+	if len(b) != 4 {
+		return "", fmt.Errorf("invalid atom name %q", name)
+	}
+	return string(b), nil
+}
+
+type span struct {
+	typ        string
+	start, end int // whole box
+	hdr        int // header length
+}
+
+// children lists the boxes in b.
+func children(b []byte) ([]span, error) {
+	var boxes []span
+	for off := 0; off < len(b); {
+		if len(b)-off < 8 {
+			return nil, errors.New("truncated box header")
+		}
+		size := int(binary.BigEndian.Uint32(b[off:]))
+		hdr := 8
+		switch size {
+		case 0:
+			size = len(b) - off
+		case 1:
+			if len(b)-off < 16 {
+				return nil, errors.New("truncated box header")
+			}
+			size = int(binary.BigEndian.Uint64(b[off+8:]))
+			hdr = 16
+		}
+		if size < hdr || off+size > len(b) {
+			return nil, fmt.Errorf("invalid size of box %q", b[off+4:off+8])
+		}
+		boxes = append(boxes, span{typ: string(b[off+4 : off+8]), start: off, end: off + size, hdr: hdr})
+		off += size
+	}
+	return boxes, nil
+}
+
+func makeBox(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// replaceChild returns the container payload with its first child of type typ replaced by fn(child),
+// where child is nil when there is none and the result is appended instead.
+func replaceChild(payload []byte, typ string, fn func(child []byte) ([]byte, error)) ([]byte, error) {
+	boxes, err := children(payload)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range boxes {
+		if c.typ != typ {
+			continue
+		}
+		box, err := fn(payload[c.start:c.end])
+		if err != nil {
+			return nil, err
+		}
+		out := append([]byte{}, payload[:c.start]...)
+		out = append(out, box...)
+		return append(out, payload[c.end:]...), nil
+	}
+	box, err := fn(nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, payload...), box...), nil
+}
+
+// payloadOf returns the content of a box; nil for nil.
+func payloadOf(box []byte) []byte {
+	if box == nil {
+		return nil
+	}
+	if binary.BigEndian.Uint32(box) == 1 {
+		return box[16:]
+	}
+	return box[8:]
+}
+
+var metaHandler = makeBox("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 9))
+
+func updateMeta(meta []byte, fn func(ilst []byte) ([]byte, error)) ([]byte, error) {
+	payload := payloadOf(meta)
+	if payload == nil {
+		payload = append(make([]byte, 4), metaHandler...)
+	}
+	// meta is a full box, except in some QuickTime files where the handler follows the header directly
+	head := 4
+	if len(payload) >= 8 && string(payload[4:8]) == "hdlr" {
+		head = 0
+	}
+	if len(payload) < head {
+		return nil, errors.New("invalid meta box")
+	}
+	rest, err := replaceChild(payload[head:], "ilst", func(ilst []byte) ([]byte, error) {
+		items, err := fn(payloadOf(ilst))
+		if err != nil {
+			return nil, err
+		}
+		return makeBox("ilst", items), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return makeBox("meta", payload[:head], rest), nil
+}
+
+// setItems replaces or removes the items of ilst named in items; new items are appended.
+func setItems(ilst []byte, items []Item) ([]byte, error) {
+	names := make([]string, len(items))
+	for i, item := range items {
+		name, err := atomName(item.Name)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+	boxes, err := children(ilst)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, c := range boxes {
+		keep := true
+		for _, name := range names {
+			if c.typ == name {
+				keep = false
+			}
+		}
+		if keep {
+			out = append(out, ilst[c.start:c.end]...)
+		}
+	}
+	for i, item := range items {
+		if len(item.Values) == 0 {
+			continue
+		}
+		head := make([]byte, 8)
+		binary.BigEndian.PutUint32(head, item.Type&0xFFFFFF)
+		var data []byte
+		for _, v := range item.Values {
+			data = append(data, makeBox("data", head, v)...)
+		}
+		out = append(out, makeBox(names[i], data)...)
+	}
+	return out, nil
+}
+
+// containers holding the sample tables of every track.
+var sampleTablePath = map[string]bool{"trak": true, "mdia": true, "minf": true, "stbl": true}
+
+// shiftChunkOffsets adds delta to every stco and co64 entry of moov's payload, in place.
+func shiftChunkOffsets(b []byte, delta int64) error {
+	boxes, err := children(b)
+	if err != nil {
+		return err
+	}
+	for _, c := range boxes {
+		p := b[c.start+c.hdr : c.end]
+		switch {
+		case sampleTablePath[c.typ]:
+			if err := shiftChunkOffsets(p, delta); err != nil {
+				return err
+			}
+		case c.typ == "stco" || c.typ == "co64":
+			if len(p) < 8 {
+				return fmt.Errorf("invalid %s box", c.typ)
+			}
+			n := int(binary.BigEndian.Uint32(p[4:]))
+			width := 4
+			if c.typ == "co64" {
+				width = 8
+			}
+			if len(p) < 8+n*width {
+				return fmt.Errorf("invalid %s box", c.typ)
+			}
+			for i := 0; i < n; i++ {
+				e := p[8+i*width:]
+				if width == 4 {
+					off := int64(binary.BigEndian.Uint32(e)) + delta
+					if off > 0xFFFFFFFF {
+						return errors.New("chunk offset overflows stco")
+					}
+					binary.BigEndian.PutUint32(e, uint32(off))
+				} else {
+					binary.BigEndian.PutUint64(e, uint64(int64(binary.BigEndian.Uint64(e))+delta))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type fileBox struct {
+	typ        string
+	start, end int64
+}
+
+func topLevel(f *os.File) ([]fileBox, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var boxes []fileBox
+	head := make([]byte, 16)
+	for off := int64(0); off < info.Size(); {
+		if _, err := f.ReadAt(head[:8], off); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(head))
+		switch size {
+		case 0:
+			size = info.Size() - off
+		case 1:
+			if _, err := f.ReadAt(head[8:], off+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(head[8:]))
+		}
+		if size < 8 || off+size > info.Size() {
+			return nil, fmt.Errorf("invalid size of box %q", head[4:8])
+		}
+		boxes = append(boxes, fileBox{typ: string(head[4:8]), start: off, end: off + size})
+		off += size
+	}
+	return boxes, nil
+}
+
+// Set writes items into the ilst box of the file at path, creating udta, meta and ilst as needed.
+func Set(path string, items ...Item) error {
+	return update(path, func(ilst []byte) ([]byte, error) {
+		return setItems(ilst, items)
+	})
+}
+
+// EnsureIlst creates an empty ilst box if the file has none, as go-mp4tag requires one.
+func EnsureIlst(path string) error {
+	return update(path, func(ilst []byte) ([]byte, error) {
+		return ilst, nil
+	})
+}
+
+// Items returns the ilst items of the file at path, keyed by atom name with '©' as in Item.Name.
+func Items(path string) (map[string]Item, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	moov, _, err := readMoov(f)
+	if err != nil {
+		return nil, err
+	}
+	items := map[string]Item{}
+	ilst := find(payloadOf(moov), "udta", "meta", "ilst")
+	boxes, err := children(ilst)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range boxes {
+		name := c.typ
+		if name[0] == 0xA9 {
+			name = "©" + name[1:]
+		}
+		item := Item{Name: name}
+		payload := ilst[c.start+c.hdr : c.end]
+		data, err := children(payload)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range data {
+			if d.typ != "data" || d.end-d.start < d.hdr+8 {
+				continue
+			}
+			p := payload[d.start+d.hdr : d.end]
+			item.Type = binary.BigEndian.Uint32(p) & 0xFFFFFF
+			item.Values = append(item.Values, p[8:])
+		}
+		if len(item.Values) > 0 {
+			items[name] = item
+		}
+	}
+	return items, nil
+}
+
+// find returns the payload of the box at path below the container payload b, or nil.
+func find(b []byte, path ...string) []byte {
+	for i, typ := range path {
+		boxes, err := children(b)
+		if err != nil {
+			return nil
+		}
+		var next []byte
+		for _, c := range boxes {
+			if c.typ == typ {
+				next = b[c.start+c.hdr : c.end]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		// skip the version and flags of meta, see updateMeta
+		if typ == "meta" && i < len(path)-1 && len(next) >= 4 && !(len(next) >= 8 && string(next[4:8]) == "hdlr") {
+			next = next[4:]
+		}
+		b = next
+	}
+	return b
+}
+
+func readMoov(f *os.File) ([]byte, fileBox, error) {
+	boxes, err := topLevel(f)
+	if err != nil {
+		return nil, fileBox{}, err
+	}
+	for _, b := range boxes {
+		if b.typ == "moov" {
+			moov := make([]byte, b.end-b.start)
+			if _, err := f.ReadAt(moov, b.start); err != nil {
+				return nil, fileBox{}, err
+			}
+			return moov, b, nil
+		}
+	}
+	return nil, fileBox{}, errors.New("moov box not found")
+}
+
+func update(path string, fn func(ilst []byte) ([]byte, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	boxes, err := topLevel(f)
+	if err != nil {
+		return err
+	}
+	moov, moovBox, err := readMoov(f)
+	if err != nil {
+		return err
+	}
+	payload, err := replaceChild(payloadOf(moov), "udta", func(udta []byte) ([]byte, error) {
+		p, err := replaceChild(payloadOf(udta), "meta", func(meta []byte) ([]byte, error) {
+			return updateMeta(meta, fn)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return makeBox("udta", p), nil
+	})
+	if err != nil {
+		return err
+	}
+	newMoov := makeBox("moov", payload)
+	delta := int64(len(newMoov)) - int64(len(moov))
+	for _, b := range boxes {
+		if b.typ == "mdat" && b.start > moovBox.start {
+			if err := shiftChunkOffsets(payloadOf(newMoov), delta); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mp4meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(f, 0, moovBox.start)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(newMoov); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(f, moovBox.end, info.Size()-moovBox.end)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,113 @@
+package mp4meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile writes ftyp, a moov whose single stco points at the samples, and the mdat.
+func writeTestFile(t *testing.T, withIlst bool) (string, []byte) {
+	t.Helper()
+	samples := []byte("sample data")
+	ftyp := makeBox("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	stcoPayload := make([]byte, 12)
+	binary.BigEndian.PutUint32(stcoPayload[4:], 1)
+	var udta []byte
+	if withIlst {
+		ilst := makeBox("ilst", makeBox("\xa9nam", makeBox("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte("Title"))))
+		udta = makeBox("udta", makeBox("meta", make([]byte, 4), metaHandler, ilst))
+	}
+	build := func(offset uint32) []byte {
+		binary.BigEndian.PutUint32(stcoPayload[8:], offset)
+		stbl := makeBox("stbl", makeBox("stco", stcoPayload))
+		trak := makeBox("trak", makeBox("mdia", makeBox("minf", stbl)))
+		return makeBox("moov", trak, udta)
+	}
+	moov := build(0)
+	moov = build(uint32(len(ftyp) + len(moov) + 8))
+	var file []byte
+	file = append(file, ftyp...)
+	file = append(file, moov...)
+	file = append(file, makeBox("mdat", samples)...)
+	path := filepath.Join(t.TempDir(), "track.m4a")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, samples
+}
+
+// samplesAt follows the stco entry of the file and returns the bytes it points at.
+func samplesAt(t *testing.T, path string, n int) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	moov, _, err := readMoov(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stco := find(payloadOf(moov), "trak", "mdia", "minf", "stbl", "stco")
+	data, _ := os.ReadFile(path)
+	off := binary.BigEndian.Uint32(stco[8:])
+	return data[off : int(off)+n]
+}
+
+func TestSetCreatesIlst(t *testing.T) {
+	path, samples := writeTestFile(t, false)
+	if err := Set(path, Flag("cpil", true), Text("©wrk", "Symphony No. 5"), Int("cnID", 1440833098, 4)); err != nil {
+		t.Fatal(err)
+	}
+	items, err := Items(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it := items["cpil"]; it.Type != TypeInteger || !bytes.Equal(it.Values[0], []byte{1}) {
+		t.Errorf("cpil = %+v", it)
+	}
+	if it := items["©wrk"]; string(it.Values[0]) != "Symphony No. 5" {
+		t.Errorf("©wrk = %+v", it)
+	}
+	if it := items["cnID"]; binary.BigEndian.Uint32(it.Values[0]) != 1440833098 {
+		t.Errorf("cnID = %+v", it)
+	}
+	if got := samplesAt(t, path, len(samples)); !bytes.Equal(got, samples) {
+		t.Errorf("chunk offset points at %q after moov grew", got)
+	}
+}
+
+func TestSetReplacesAndRemoves(t *testing.T) {
+	path, samples := writeTestFile(t, true)
+	if err := Set(path, Flag("cpil", true), Flag("pgap", true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set(path, Flag("cpil", false), Text("©nam", "New Title"), TextList("©gen", []string{"Pop", "", "Rock"})); err != nil {
+		t.Fatal(err)
+	}
+	items, err := Items(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := items["cpil"]; ok {
+		t.Error("cpil was not removed")
+	}
+	if _, ok := items["pgap"]; !ok {
+		t.Error("pgap was lost")
+	}
+	if it := items["©nam"]; len(it.Values) != 1 || string(it.Values[0]) != "New Title" {
+		t.Errorf("©nam = %q", it.Values)
+	}
+	if it := items["©gen"]; len(it.Values) != 2 || string(it.Values[1]) != "Rock" {
+		t.Errorf("©gen = %q", it.Values)
+	}
+	if len(items) != 3 {
+		t.Errorf("items = %v", items)
+	}
+	if got := samplesAt(t, path, len(samples)); !bytes.Equal(got, samples) {
+		t.Errorf("chunk offset points at %q after moov changed", got)
+	}
+}
@@ -0,0 +1,278 @@
+// Package naming renders the folder and file name templates of config.yaml.
+//
+// A template is literal text with placeholders:
+//
+//	{Field}              value of Field
+//	{A|B|C}              first non-empty of A, B and C
+//	{Field:02}           zero-pad a number to 2 digits
+//	{Field:upper}        upper, lower or title case
+//	{Field:max=20}       truncate to 20 characters
+//	<text {Field} text>  drop the whole segment when any field inside it is empty
+//
+// Modifiers can be chained, e.g. {AlbumArtist|ArtistName:lower:max=30}.
+// A '{' that does not start a placeholder is kept as is, so "{{Tag}}" renders as "{[E]}".
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fields maps field names to their values for one rendering.
+type Fields map[string]string
+
+type modifier struct {
+	kind  string // pad, upper, lower, title, max
+	width int
+}
+
+type node struct {
+	text     string   // literal text when names is empty
+	names    []string // fallback chain of a placeholder
+	mods     []modifier
+	optional []node // children of a <...> segment
+	isGroup  bool
+}
+
+// Template is a parsed naming template.
+type Template struct {
+	raw   string
+	nodes []node
+}
+
+var placeholder = regexp.MustCompile(`^\{([A-Za-z][A-Za-z0-9]*(?:\|[A-Za-z][A-Za-z0-9]*)*)((?::[^:{}<>]+)*)\}`)
+
+// Parse parses a template.
+func Parse(s string) (*Template, error) {
+	t := &Template{raw: s}
+	var group *node
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() == 0 {
+			return
+		}
+		n := node{text: lit.String()}
+		lit.Reset()
+		if group != nil {
+			group.optional = append(group.optional, n)
+		} else {
+			t.nodes = append(t.nodes, n)
+		}
+	}
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			if group != nil {
+				return nil, fmt.Errorf("nested '<' at offset %d", i)
+			}
+			flush()
+			group = &node{isGroup: true}
+			i++
+		case '>':
+			if group == nil {
+				return nil, fmt.Errorf("unmatched '>' at offset %d", i)
+			}
+			flush()
+			t.nodes = append(t.nodes, *group)
+			group = nil
+			i++
+		case '{':
+			m := placeholder.FindStringSubmatch(s[i:])
+			if m == nil {
+				lit.WriteByte('{')
+				i++
+				continue
+			}
+			mods, err := parseModifiers(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", m[0], err)
+			}
+			flush()
+			n := node{names: strings.Split(m[1], "|"), mods: mods}
+			if group != nil {
+				group.optional = append(group.optional, n)
+			} else {
+				t.nodes = append(t.nodes, n)
+			}
+			i += len(m[0])
+		default:
+			lit.WriteByte(s[i])
+			i++
+		}
+	}
+	if group != nil {
+		return nil, errors.New("unclosed '<'")
+	}
+	flush()
+	return t, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for built-in templates.
+func MustParse(s string) *Template {
+	t, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parseModifiers(s string) ([]modifier, error) {
+	var mods []modifier
+	for _, m := range strings.Split(s, ":") {
+		if m == "" {
+			continue
+		}
+		switch {
+		case m == "upper" || m == "lower" || m == "title":
+			mods = append(mods, modifier{kind: m})
+		case strings.HasPrefix(m, "max="):
+			n, err := strconv.Atoi(m[len("max="):])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid modifier %q", m)
+			}
+			mods = append(mods, modifier{kind: "max", width: n})
+		default:
+			n, err := strconv.Atoi(m)
+			if err != nil || n <= 0 || strings.TrimLeft(m, "0123456789") != "" {
+				return nil, fmt.Errorf("invalid modifier %q", m)
+			}
+			mods = append(mods, modifier{kind: "pad", width: n})
+		}
+	}
+	return mods, nil
+}
+
+// String returns the template source.
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Fields returns every field name referenced by the template, in order of appearance.
+func (t *Template) Fields() []string {
+	var names []string
+	seen := map[string]bool{}
+	var walk func([]node)
+	walk = func(nodes []node) {
+		for _, n := range nodes {
+			walk(n.optional)
+			for _, name := range n.names {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	walk(t.nodes)
+	return names
+}
+
+// Uses reports whether the template references field, e.g. to skip computing an expensive value.
+func (t *Template) Uses(field string) bool {
+	for _, name := range t.Fields() {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error naming the first field that is not in allowed.
+func (t *Template) Validate(allowed []string) error {
+	ok := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		ok[name] = true
+	}
+	for _, name := range t.Fields() {
+		if !ok[name] {
+			return fmt.Errorf("unknown field {%s}", name)
+		}
+	}
+	return nil
+}
+
+// Render fills the template with f. Missing fields render empty.
+func (t *Template) Render(f Fields) string {
+	var b strings.Builder
+	for _, n := range t.nodes {
+		if n.isGroup {
+			if s, ok := renderAll(n.optional, f); ok {
+				b.WriteString(s)
+			}
+			continue
+		}
+		s, _ := n.render(f)
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// renderAll renders a <...> segment and reports whether all of its fields were non-empty.
+func renderAll(nodes []node, f Fields) (string, bool) {
+	var b strings.Builder
+	for _, n := range nodes {
+		s, ok := n.render(f)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(s)
+	}
+	return b.String(), true
+}
+
+func (n node) render(f Fields) (string, bool) {
+	if n.names == nil {
+		return n.text, true
+	}
+	var v string
+	for _, name := range n.names {
+		if v = f[name]; v != "" {
+			break
+		}
+	}
+	if v == "" {
+		return "", false
+	}
+	for _, m := range n.mods {
+		v = m.apply(v)
+	}
+	return v, true
+}
+
+func (m modifier) apply(v string) string {
+	switch m.kind {
+	case "upper":
+		return strings.ToUpper(v)
+	case "lower":
+		return strings.ToLower(v)
+	case "title":
+		return titleCase(v)
+	case "max":
+		if utf8.RuneCountInString(v) > m.width {
+			return strings.TrimSpace(string([]rune(v)[:m.width]))
+		}
+	case "pad":
+		if n, err := strconv.Atoi(v); err == nil {
+			return fmt.Sprintf("%0*d", m.width, n)
+		}
+	}
+	return v
+}
+
+// titleCase upper-cases the first letter of every word and leaves the rest alone,
+// so names like "AC/DC" or "iPhone" survive.
+func titleCase(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,70 @@
+package naming
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	fields := Fields{
+		"ArtistName":  "the beatles",
+		"AlbumName":   "Abbey Road (Remastered)",
+		"SongNumber":  "07",
+		"DiscNumber":  "1",
+		"ReleaseYear": "1969",
+		"Tag":         "[M]",
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"{AlbumName}", "Abbey Road (Remastered)"},
+		{"{AlbumArtist|ArtistName}", "the beatles"},
+		{"{ArtistName:upper} - {AlbumName:lower}", "THE BEATLES - abbey road (remastered)"},
+		{"{ArtistName:title}", "The Beatles"},
+		{"{AlbumName:max=10}", "Abbey Road"},
+		{"{SongNumber:03} {DiscNumber:02}", "007 01"},
+		{"{SongNumber:1}", "7"},
+		{"{AlbumName:max=5:upper}", "ABBEY"},
+		{"{ReleaseYear}< - {Quality}> - {AlbumName}", "1969 - Abbey Road (Remastered)"},
+		{"<[{Codec}] >{AlbumName}", "Abbey Road (Remastered)"},
+		{"{AlbumName} <({ReleaseYear})>", "Abbey Road (Remastered) (1969)"},
+		{"[{Quality}]{{Tag}}", "[]{[M]}"},
+		{"{ not a field } {}", "{ not a field } {}"},
+		{"{Missing}", ""},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.format)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.format, err)
+			continue
+		}
+		if got := tmpl.Render(fields); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, format := range []string{
+		"{AlbumName:reverse}",
+		"{AlbumName:max=0}",
+		"<{AlbumName}",
+		"{AlbumName}>",
+		"<<{AlbumName}>>",
+	} {
+		if _, err := Parse(format); err == nil {
+			t.Errorf("Parse(%q) succeeded", format)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tmpl := MustParse("{AlbumArtist|ArtistName} - <{Quality}>")
+	if err := tmpl.Validate([]string{"ArtistName", "AlbumArtist", "Quality"}); err != nil {
+		t.Error(err)
+	}
+	if err := tmpl.Validate([]string{"ArtistName", "Quality"}); err == nil {
+		t.Error("Validate accepted {AlbumArtist}")
+	}
+	if !tmpl.Uses("Quality") || tmpl.Uses("Codec") {
+		t.Errorf("Uses: fields = %v", tmpl.Fields())
+	}
+}
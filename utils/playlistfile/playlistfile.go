@@ -0,0 +1,78 @@
+package playlistfile
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Entry is one track of an exported playlist. Path is relative to the playlist file.
+type Entry struct {
+	Path           string
+	Title          string
+	Artist         string
+	Album          string
+	DurationMillis int
+}
+
+// WriteM3U8 writes an extended M3U8 playlist.
+func WriteM3U8(path string, name string, entries []Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "#EXTM3U")
+	if name != "" {
+		fmt.Fprintf(w, "#PLAYLIST:%s\n", name)
+	}
+	for _, e := range entries {
+		title := e.Title
+		if e.Artist != "" {
+			title = e.Artist + " - " + e.Title
+		}
+		fmt.Fprintf(w, "#EXTINF:%d,%s\n", (e.DurationMillis+500)/1000, title)
+		fmt.Fprintln(w, e.Path)
+	}
+	return w.Flush()
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"`
+}
+
+// WriteXSPF writes an XSPF playlist. Locations are relative URIs.
+func WriteXSPF(path string, name string, entries []Entry) error {
+	p := xspfPlaylist{Version: "1", Xmlns: "http://xspf.org/ns/0/", Title: name}
+	for _, e := range entries {
+		location := &url.URL{Path: filepath.ToSlash(e.Path)}
+		p.Tracks = append(p.Tracks, xspfTrack{
+			Location: location.String(),
+			Title:    e.Title,
+			Creator:  e.Artist,
+			Album:    e.Album,
+			Duration: e.DurationMillis,
+		})
+	}
+	data, err := xml.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
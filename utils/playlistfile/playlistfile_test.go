@@ -0,0 +1,50 @@
+package playlistfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var entries = []Entry{
+	{Path: "01. Shake It Off.m4a", Title: "Shake It Off", Artist: "Taylor Swift", Album: "1989", DurationMillis: 219209},
+	{Path: filepath.Join("..", "..", "Taylor Swift", "Fearless", "03. Love Story.m4a"), Title: "Love Story", Artist: "Taylor Swift", DurationMillis: 235280},
+}
+
+func TestWriteM3U8(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Essentials.m3u8")
+	if err := WriteM3U8(path, "Taylor Swift Essentials", entries); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(path)
+	want := "#EXTM3U\n" +
+		"#PLAYLIST:Taylor Swift Essentials\n" +
+		"#EXTINF:219,Taylor Swift - Shake It Off\n" +
+		"01. Shake It Off.m4a\n" +
+		"#EXTINF:235,Taylor Swift - Love Story\n" +
+		filepath.Join("..", "..", "Taylor Swift", "Fearless", "03. Love Story.m4a") + "\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteXSPF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Essentials.xspf")
+	if err := WriteXSPF(path, "Taylor Swift Essentials", entries); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	got := string(data)
+	for _, want := range []string{
+		`<playlist version="1" xmlns="http://xspf.org/ns/0/">`,
+		`<location>01.%20Shake%20It%20Off.m4a</location>`,
+		`<location>../../Taylor%20Swift/Fearless/03.%20Love%20Story.m4a</location>`,
+		`<duration>219209</duration>`,
+		`<creator>Taylor Swift</creator>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"time"
+)
+
+// Track outcomes, matching the counters of the console summary.
+const (
+	Success     = "success"
+	Unavailable = "unavailable"
+	NotSong     = "not-song"
+	Error       = "error"
+)
+
+type Track struct {
+	ID      string `json:"id"`
+	Type    string `json:"type,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Codec   string `json:"codec,omitempty"`
+	Quality string `json:"quality,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Failed reports whether the track should be retried.
+func (t Track) Failed() bool {
+	return t.Outcome == Error || t.Outcome == Unavailable
+}
+
+// Item is one queued URL and every track processed for it.
+type Item struct {
+	URL        string   `json:"url"`
+	Options    []string `json:"options,omitempty"`
+	ArtistName string   `json:"artistName,omitempty"` // artist page the URL was expanded from
+	ArtistID   string   `json:"artistId,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Tracks     []Track  `json:"tracks"`
+}
+
+type Summary struct {
+	Total       int `json:"total"`
+	Success     int `json:"success"`
+	Unavailable int `json:"unavailable"`
+	NotSong     int `json:"notSong"`
+	Error       int `json:"error"`
+}
+
+// Report is the machine-readable counterpart of the console summary.
+// A nil *Report and a nil *Item are valid and record nothing.
+type Report struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Summary  Summary   `json:"summary"`
+	Items    []*Item   `json:"items"`
+}
+
+func New() *Report {
+	return &Report{Started: time.Now()}
+}
+
+// Load reads a report written by Write.
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Report)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Add starts the entry for a queued URL. When the URL was already reported with the same options,
+// e.g. on a retry, its entry is reused so later results replace earlier ones; the same URL queued
+// with other options (say once plain and once with --atmos) gets an entry of its own.
+func (r *Report) Add(url string, options []string) *Item {
+	if r == nil {
+		return nil
+	}
+	for _, item := range r.Items {
+		if item.URL == url && slices.Equal(item.Options, options) {
+			item.Error = ""
+			return item
+		}
+	}
+	item := &Item{URL: url, Options: options, Tracks: []Track{}}
+	r.Items = append(r.Items, item)
+	return item
+}
+
+// AddTrack records t, replacing an earlier result for the same track.
+func (item *Item) AddTrack(t Track) {
+	if item == nil {
+		return
+	}
+	for i := range item.Tracks {
+		if item.Tracks[i].ID == t.ID {
+			item.Tracks[i] = t
+			return
+		}
+	}
+	item.Tracks = append(item.Tracks, t)
+}
+
+// Fail records an error that stopped the URL before (or while) its tracks were processed.
+func (item *Item) Fail(err error) {
+	if item == nil || err == nil {
+		return
+	}
+	item.Error = err.Error()
+}
+
+// Write stores the report as indented JSON at path. The summary counts the latest outcome
+// of every track plus every URL that failed outright.
+func (r *Report) Write(path string) error {
+	if r == nil {
+		return nil
+	}
+	r.Finished = time.Now()
+	r.Summary = Summary{}
+	for _, item := range r.Items {
+		if item.Error != "" {
+			r.Summary.Error++
+		}
+		for _, t := range item.Tracks {
+			r.Summary.Total++
+			switch t.Outcome {
+			case Success:
+				r.Summary.Success++
+			case Unavailable:
+				r.Summary.Unavailable++
+			case NotSong:
+				r.Summary.NotSong++
+			default:
+				r.Summary.Error++
+			}
+		}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,73 @@
+package report
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetryReplacesEarlierOutcomes(t *testing.T) {
+	r := New()
+	album := r.Add("https://music.apple.com/us/album/x/1", nil)
+	album.AddTrack(Track{ID: "11", Outcome: Success})
+	album.AddTrack(Track{ID: "12", Outcome: Error, Error: "Failed to run v2"})
+	album.AddTrack(Track{ID: "13", Outcome: Unavailable})
+	playlist := r.Add("https://music.apple.com/us/playlist/x/pl.1", []string{"--atmos"})
+	playlist.Fail(errors.New("error getting playlist response"))
+
+	// second pass: only the failures are run again
+	again := r.Add("https://music.apple.com/us/album/x/1", nil)
+	if again != album {
+		t.Fatal("Add did not reuse the entry of an already reported URL")
+	}
+	again.AddTrack(Track{ID: "12", Outcome: Success})
+	if r.Add("https://music.apple.com/us/playlist/x/pl.1", []string{"--atmos"}).Error != "" {
+		t.Error("Add did not clear the URL error before the retry")
+	}
+	playlist.Fail(errors.New("still failing"))
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := r.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Summary{Total: 3, Success: 2, Unavailable: 1, Error: 1}
+	if loaded.Summary != want {
+		t.Errorf("Summary = %+v, want %+v", loaded.Summary, want)
+	}
+	if len(loaded.Items) != 2 || len(loaded.Items[0].Tracks) != 3 {
+		t.Fatalf("items not merged: %+v", loaded.Items)
+	}
+	var failed []string
+	for _, track := range loaded.Items[0].Tracks {
+		if track.Failed() {
+			failed = append(failed, track.ID)
+		}
+	}
+	if len(failed) != 1 || failed[0] != "13" {
+		t.Errorf("failed tracks = %v, want [13]", failed)
+	}
+	if loaded.Items[1].Options[0] != "--atmos" || loaded.Items[1].Error != "still failing" {
+		t.Errorf("playlist item = %+v", loaded.Items[1])
+	}
+}
+
+func TestSameURLWithOtherOptions(t *testing.T) {
+	r := New()
+	plain := r.Add("https://music.apple.com/us/album/x/1", nil)
+	atmos := r.Add("https://music.apple.com/us/album/x/1", []string{"--atmos"})
+	if plain == atmos {
+		t.Fatal("Add merged the same URL queued with other options")
+	}
+	plain.AddTrack(Track{ID: "11", Outcome: Success})
+	atmos.AddTrack(Track{ID: "11", Outcome: Error, Error: "Failed to run v2"})
+	if plain.Tracks[0].Outcome != Success || !atmos.Tracks[0].Failed() {
+		t.Errorf("outcomes = %+v, %+v", plain.Tracks, atmos.Tracks)
+	}
+	if r.Add("https://music.apple.com/us/album/x/1", []string{"--atmos"}) != atmos {
+		t.Error("Add did not reuse the entry with the same options")
+	}
+}
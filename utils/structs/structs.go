@@ -8,6 +8,13 @@ type ConfigSet struct {
 	SaveLrcFile             bool   `yaml:"save-lrc-file"`
 	LrcType                 string `yaml:"lrc-type"`
 	LrcFormat               string `yaml:"lrc-format"`
+	SubtitleTranslation     bool   `yaml:"subtitle-translation"`
+	SubtitleTransliteration bool   `yaml:"subtitle-transliteration"`
+	LyricsAgentMarker       string `yaml:"lyrics-agent-marker"`
+	LyricsBackgroundVocals  string `yaml:"lyrics-background-vocals"`
+	TranslationLanguage     string `yaml:"translation-language"`
+	LrcLines                []string `yaml:"lrc-lines"`
+	LrcSeparator            string `yaml:"lrc-separator"`
 	SaveAnimatedArtwork     bool   `yaml:"save-animated-artwork"`
 	EmbyAnimatedArtwork     bool   `yaml:"emby-animated-artwork"`
 	EmbedLrc                bool   `yaml:"embed-lrc"`
@@ -22,8 +29,15 @@ type ConfigSet struct {
 	PlaylistFolderFormat    string `yaml:"playlist-folder-format"`
 	ArtistFolderFormat      string `yaml:"artist-folder-format"`
 	SongFileFormat          string `yaml:"song-file-format"`
+	DiscFolderFormat        string `yaml:"disc-folder-format"`
+	SongNumberPerDisc       bool   `yaml:"song-number-per-disc"`
+	WorkFolderFormat        string `yaml:"work-folder-format"`
+	CompilationFolder       string `yaml:"compilation-folder"`
+	CompilationArtist       string `yaml:"compilation-artist"`
+	SortArticles            []string `yaml:"sort-articles"`
 	ExplicitChoice          string `yaml:"explicit-choice"`
 	CleanChoice             string `yaml:"clean-choice"`
+	ContentPreference       string `yaml:"content-preference"`
 	AppleMasterChoice       string `yaml:"apple-master-choice"`
 	MaxMemoryLimit          int    `yaml:"max-memory-limit"`
 	DecryptM3u8Port         string `yaml:"decrypt-m3u8-port"`
@@ -46,6 +60,13 @@ type ConfigSet struct {
 	ConvertExtraArgs           string `yaml:"convert-extra-args"`
 	ConvertWarnLossyToLossless bool   `yaml:"convert-warn-lossy-to-lossless"`
 	ConvertSkipLossyToLossless bool   `yaml:"convert-skip-lossy-to-lossless"`
+	HistoryFile                string `yaml:"history-file"`
+	TrackRetries               int    `yaml:"track-retries"`
+	RetryBackoff               int    `yaml:"retry-backoff"`
+	PlaylistFileFormat         string `yaml:"playlist-file-format"`
+	PlaylistFileFolder         string `yaml:"playlist-file-folder"`
+	PlaylistDedupe             string `yaml:"playlist-dedupe"`
+	WatchFile                  string `yaml:"watch-file"`
 }
 
 type Counter struct {
@@ -55,50 +76,3 @@ type Counter struct {
 	Success     int
 	Total       int
 }
-
-// 艺术家页面
-type AutoGeneratedArtist struct {
-	Next string `json:"next"`
-	Data []struct {
-		ID         string `json:"id"`
-		Type       string `json:"type"`
-		Href       string `json:"href"`
-		Attributes struct {
-			Previews []struct {
-				URL string `json:"url"`
-			} `json:"previews"`
-			Artwork struct {
-				Width      int    `json:"width"`
-				Height     int    `json:"height"`
-				URL        string `json:"url"`
-				BgColor    string `json:"bgColor"`
-				TextColor1 string `json:"textColor1"`
-				TextColor2 string `json:"textColor2"`
-				TextColor3 string `json:"textColor3"`
-				TextColor4 string `json:"textColor4"`
-			} `json:"artwork"`
-			ArtistName           string   `json:"artistName"`
-			URL                  string   `json:"url"`
-			DiscNumber           int      `json:"discNumber"`
-			GenreNames           []string `json:"genreNames"`
-			HasTimeSyncedLyrics  bool     `json:"hasTimeSyncedLyrics"`
-			IsMasteredForItunes  bool     `json:"isMasteredForItunes"`
-			IsAppleDigitalMaster bool     `json:"isAppleDigitalMaster"`
-			ContentRating        string   `json:"contentRating"`
-			DurationInMillis     int      `json:"durationInMillis"`
-			ReleaseDate          string   `json:"releaseDate"`
-			Name                 string   `json:"name"`
-			Isrc                 string   `json:"isrc"`
-			AudioTraits          []string `json:"audioTraits"`
-			HasLyrics            bool     `json:"hasLyrics"`
-			AlbumName            string   `json:"albumName"`
-			PlayParams           struct {
-				ID   string `json:"id"`
-				Kind string `json:"kind"`
-			} `json:"playParams"`
-			TrackNumber  int    `json:"trackNumber"`
-			AudioLocale  string `json:"audioLocale"`
-			ComposerName string `json:"composerName"`
-		} `json:"attributes"`
-	} `json:"data"`
-}
\ No newline at end of file
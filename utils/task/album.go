@@ -46,6 +46,13 @@ func (a *Album) GetResp(token, l string) error {
 	if err != nil {
 		return errors.New("error getting album response")
 	}
+	a.SetResp(resp, l)
+	return nil
+}
+
+// SetResp fills the album from a response that was already fetched, in place of GetResp.
+func (a *Album) SetResp(resp *ampapi.AlbumResp, l string) {
+	a.Language = l
 	a.Resp = *resp
 	//简化高频调用名称
 	a.Name = a.Resp.Data[0].Attributes.Name
@@ -75,7 +82,6 @@ func (a *Album) GetResp(token, l string) error {
 			AlbumData: a.Resp.Data[0],
 		})
 	}
-	return nil
 }
 
 func (a *Album) GetArtwork() string {
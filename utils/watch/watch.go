@@ -0,0 +1,111 @@
+// Package watch keeps the list of artists the watch command checks for new releases.
+package watch
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Artist is one watched artist. Seen holds the IDs of the releases already downloaded or
+// reported, so a check only acts on what was released since.
+type Artist struct {
+	ID         string    `json:"id"`
+	Storefront string    `json:"storefront"`
+	Name       string    `json:"name,omitempty"`
+	Checked    time.Time `json:"checked,omitempty"`
+	Seen       []string  `json:"seen,omitempty"`
+}
+
+// List is the watch list stored as a JSON file.
+type List struct {
+	path    string
+	Artists []*Artist `json:"artists"`
+}
+
+// Load reads the watch list at path. A missing file is an empty list.
+func Load(path string) (*List, error) {
+	l := &List{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Save writes the list back to its file, replacing it only once the new one is complete.
+func (l *List) Save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".watch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// Find returns the watched artist with the given ID.
+func (l *List) Find(id string) *Artist {
+	for _, a := range l.Artists {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+// Add appends a and reports whether it was not watched yet.
+func (l *List) Add(a *Artist) bool {
+	if l.Find(a.ID) != nil {
+		return false
+	}
+	l.Artists = append(l.Artists, a)
+	return true
+}
+
+// Remove drops the artist with the given ID and reports whether it was watched.
+func (l *List) Remove(id string) bool {
+	for i, a := range l.Artists {
+		if a.ID == id {
+			l.Artists = append(l.Artists[:i], l.Artists[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// HasSeen reports whether the release with the given ID was already handled.
+func (a *Artist) HasSeen(id string) bool {
+	for _, s := range a.Seen {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkSeen records releases as handled.
+func (a *Artist) MarkSeen(ids ...string) {
+	for _, id := range ids {
+		if !a.HasSeen(id) {
+			a.Seen = append(a.Seen, id)
+		}
+	}
+}
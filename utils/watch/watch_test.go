@@ -0,0 +1,54 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.json")
+	l, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Artists) != 0 {
+		t.Fatalf("missing file loaded %d artists", len(l.Artists))
+	}
+	if !l.Add(&Artist{ID: "159260351", Storefront: "us", Name: "Taylor Swift"}) {
+		t.Fatal("Add reported a new artist as watched")
+	}
+	if l.Add(&Artist{ID: "159260351", Storefront: "jp"}) {
+		t.Fatal("Add accepted an artist twice")
+	}
+	l.Add(&Artist{ID: "1", Storefront: "us"})
+	a := l.Find("159260351")
+	a.MarkSeen("1713845538", "1440833098", "1713845538")
+	a.Checked = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	if !l.Remove("1") || l.Remove("1") {
+		t.Fatal("Remove did not drop the artist exactly once")
+	}
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Artists) != 1 {
+		t.Fatalf("loaded %d artists", len(l.Artists))
+	}
+	a = l.Artists[0]
+	if a.Name != "Taylor Swift" || a.Storefront != "us" || !a.Checked.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("artist = %+v", a)
+	}
+	if len(a.Seen) != 2 || !a.HasSeen("1440833098") || a.HasSeen("1") {
+		t.Errorf("seen = %v", a.Seen)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}